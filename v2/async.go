@@ -0,0 +1,52 @@
+package gobreaker
+
+import "context"
+
+// Result holds the result of a request executed by CircuitBreaker.
+// Err is wrapped by CircuitBreaker only for IsRetryable if RetryableClassifier is set,
+// so errors.Is and IsBreakerError tell the errors of CircuitBreaker from those of the request.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// ExecuteAsync runs the given request in a new goroutine if the CircuitBreaker accepts it
+// and returns a channel that delivers the Result and is closed afterwards.
+// The Result has the same value and error as Execute would return.
+// If ctx is done before the request completes, the Result has the error of ctx instead,
+// while the request keeps running and its outcome is still counted.
+// A panic in the request is counted as a failure and delivered as a PanicError,
+// whether RecoverPanics is set or not.
+func (cb *CircuitBreaker[T]) ExecuteAsync(ctx context.Context, req func() (T, error)) <-chan Result[T] {
+	ch := make(chan Result[T], 1)
+
+	go func() {
+		defer close(ch)
+
+		if err := ctx.Err(); err != nil {
+			ch <- Result[T]{Err: err}
+			return
+		}
+
+		done := make(chan Result[T], 1)
+		go func() {
+			defer func() {
+				if e := recover(); e != nil {
+					done <- Result[T]{Err: &PanicError{Value: e}}
+				}
+			}()
+
+			value, err := cb.Execute(req)
+			done <- Result[T]{Value: value, Err: err}
+		}()
+
+		select {
+		case result := <-done:
+			ch <- result
+		case <-ctx.Done():
+			ch <- Result[T]{Err: ctx.Err()}
+		}
+	}()
+
+	return ch
+}
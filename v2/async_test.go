@@ -0,0 +1,79 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteAsync(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	result := <-cb.ExecuteAsync(context.Background(), func() (int, error) { return 1, nil })
+	assert.Equal(t, Result[int]{Value: 1}, result)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0}, cb.Counts())
+
+	errFail := errors.New("fail")
+	for i := 0; i < 6; i++ {
+		result = <-cb.ExecuteAsync(context.Background(), func() (int, error) { return 0, errFail })
+		assert.Equal(t, errFail, result.Err)
+		assert.False(t, IsBreakerError(result.Err))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	called := false
+	ch := cb.ExecuteAsync(context.Background(), func() (int, error) {
+		called = true
+		return 1, nil
+	})
+	result = <-ch
+	assert.Equal(t, Result[int]{Err: ErrOpenState}, result)
+	assert.True(t, errors.Is(result.Err, ErrOpenState))
+	assert.True(t, IsBreakerError(result.Err))
+	_, ok := <-ch
+	assert.False(t, ok)
+	assert.False(t, called)
+}
+
+func TestExecuteAsyncCanceled(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	release := make(chan struct{})
+	ch := cb.ExecuteAsync(ctx, func() (int, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	<-started
+	cancel()
+	assert.Equal(t, Result[int]{Err: context.Canceled}, <-ch)
+
+	close(release)
+	assert.Eventually(t, func() bool {
+		return cb.Counts() == Counts{1, 1, 0, 1, 0, 0}
+	}, time.Second, time.Duration(10)*time.Millisecond)
+
+	called := false
+	ch = cb.ExecuteAsync(ctx, func() (int, error) {
+		called = true
+		return 1, nil
+	})
+	assert.Equal(t, Result[int]{Err: context.Canceled}, <-ch)
+	assert.False(t, called)
+}
+
+func TestExecuteAsyncPanic(t *testing.T) {
+	for _, recoverPanics := range []bool{false, true} {
+		cb := NewCircuitBreaker[int](Settings{RecoverPanics: recoverPanics})
+
+		result := <-cb.ExecuteAsync(context.Background(), func() (int, error) { panic("oops") })
+		assert.True(t, errors.Is(result.Err, ErrPanic))
+		assert.EqualError(t, result.Err, "panic: oops")
+		assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, cb.Counts())
+	}
+}
@@ -0,0 +1,45 @@
+package gobreaker
+
+import "time"
+
+// bulkhead is a semaphore of the slots for concurrent requests.
+type bulkhead struct {
+	slots   chan struct{}
+	maxWait time.Duration
+}
+
+func newBulkhead(maxConcurrent uint32, maxWait time.Duration) *bulkhead {
+	return &bulkhead{
+		slots:   make(chan struct{}, maxConcurrent),
+		maxWait: maxWait,
+	}
+}
+
+// acquire takes a slot, waiting up to maxWait for a slot to be released,
+// and reports whether it took one.
+func (b *bulkhead) acquire() bool {
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	default:
+	}
+
+	if b.maxWait <= 0 {
+		return false
+	}
+
+	timer := time.NewTimer(b.maxWait)
+	defer timer.Stop()
+
+	select {
+	case b.slots <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// release returns a slot taken by acquire.
+func (b *bulkhead) release() {
+	<-b.slots
+}
@@ -0,0 +1,115 @@
+package gobreaker
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// occupy runs a request through cb that holds a slot until release is closed.
+func occupy(cb *CircuitBreaker[bool], release chan struct{}) <-chan error {
+	started := make(chan struct{})
+	ch := make(chan error, 1)
+	go func() {
+		_, err := cb.Execute(func() (bool, error) {
+			close(started)
+			<-release
+			return true, nil
+		})
+		ch <- err
+	}()
+	<-started
+	return ch
+}
+
+func TestBulkhead(t *testing.T) {
+	var reasons []RejectReason
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxConcurrent: 2,
+		OnReject:      func(_ string, reason RejectReason) { reasons = append(reasons, reason) },
+	})
+
+	release := make(chan struct{})
+	ch1 := occupy(cb, release)
+	ch2 := occupy(cb, release)
+
+	assert.Equal(t, ErrBulkheadFull, succeed(cb))
+	assert.Equal(t, []RejectReason{RejectBulkheadFull}, reasons)
+	assert.Equal(t, Counts{2, 0, 0, 0, 0, 0}, cb.Counts())
+
+	close(release)
+	assert.Nil(t, <-ch1)
+	assert.Nil(t, <-ch2)
+
+	// the slots are released
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{3, 3, 0, 3, 0, 0}, cb.Counts())
+}
+
+func TestBulkheadRejectSerialized(t *testing.T) {
+	var inside, overlapped atomic.Bool
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxConcurrent: 1,
+		OnReject: func(string, RejectReason) {
+			if inside.Swap(true) {
+				overlapped.Store(true)
+			}
+			time.Sleep(time.Millisecond)
+			inside.Store(false)
+		},
+	})
+
+	release := make(chan struct{})
+	ch := occupy(cb, release)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				_ = succeed(cb)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.False(t, overlapped.Load())
+	assert.Equal(t, uint64(20), cb.Metrics().Rejections)
+
+	close(release)
+	assert.Nil(t, <-ch)
+}
+
+func TestBulkheadWait(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxConcurrent: 1,
+		MaxWait:       time.Duration(50) * time.Millisecond,
+	})
+
+	release := make(chan struct{})
+	ch := occupy(cb, release)
+
+	// the waiting request times out
+	start := time.Now()
+	assert.Equal(t, ErrBulkheadFull, succeed(cb))
+	assert.True(t, time.Since(start) >= cb.bulkhead.maxWait)
+
+	// the waiting request takes the slot released in time
+	go func() {
+		time.Sleep(time.Duration(10) * time.Millisecond)
+		close(release)
+	}()
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, <-ch)
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0}, cb.Counts())
+}
+
+func TestBulkheadPanic(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MaxConcurrent: 1})
+
+	assert.Panics(t, func() { _ = causePanic(cb) })
+	assert.Nil(t, succeed(cb))
+}
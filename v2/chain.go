@@ -0,0 +1,28 @@
+package gobreaker
+
+import "errors"
+
+// Fallback is a request guarded by its own CircuitBreaker, to be tried in a Chain.
+type Fallback[T any] struct {
+	Breaker *CircuitBreaker[T]
+	Req     func() (T, error)
+}
+
+// Chain executes the requests of fallbacks in order by their CircuitBreakers
+// until one of them succeeds, and returns the result of the first success.
+// A request is tried if the previous one is rejected, e.g. with ErrOpenState, or fails.
+// If all of them are rejected or fail, Chain returns the zero value of T
+// and the errors of all the requests joined by errors.Join.
+func Chain[T any](fallbacks ...Fallback[T]) (T, error) {
+	errs := make([]error, 0, len(fallbacks))
+	for _, f := range fallbacks {
+		result, err := f.Breaker.Execute(f.Req)
+		if err == nil {
+			return result, nil
+		}
+		errs = append(errs, err)
+	}
+
+	var defaultValue T
+	return defaultValue, errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChain(t *testing.T) {
+	primary := NewCircuitBreaker[string](Settings{Name: "primary"})
+	secondary := NewCircuitBreaker[string](Settings{Name: "secondary"})
+
+	errPrimary := errors.New("primary down")
+	primaryCalls := 0
+	primaryReq := func() (string, error) {
+		primaryCalls++
+		return "", errPrimary
+	}
+	secondaryReq := func() (string, error) { return "secondary", nil }
+
+	// the failure of the primary falls back to the secondary
+	result, err := Chain(Fallback[string]{primary, primaryReq}, Fallback[string]{secondary, secondaryReq})
+	assert.Equal(t, "secondary", result)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, primaryCalls)
+
+	// the open primary is skipped
+	for i := 0; i < 5; i++ {
+		_, _ = primary.Execute(primaryReq)
+	}
+	assert.Equal(t, StateOpen, primary.State())
+	result, err = Chain(Fallback[string]{primary, primaryReq}, Fallback[string]{secondary, secondaryReq})
+	assert.Equal(t, "secondary", result)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, primaryCalls)
+
+	// both open
+	errSecondary := errors.New("secondary down")
+	for i := 0; i < 6; i++ {
+		_, _ = secondary.Execute(func() (string, error) { return "", errSecondary })
+	}
+	assert.Equal(t, StateOpen, secondary.State())
+	result, err = Chain(Fallback[string]{primary, primaryReq}, Fallback[string]{secondary, secondaryReq})
+	assert.Equal(t, "", result)
+	assert.True(t, errors.Is(err, ErrOpenState))
+	assert.Equal(t, "circuit breaker is open\ncircuit breaker is open", err.Error())
+
+	// the first success is returned without trying the rest
+	result, err = Chain(Fallback[string]{NewCircuitBreaker[string](Settings{}), func() (string, error) { return "first", nil }},
+		Fallback[string]{secondary, secondaryReq})
+	assert.Equal(t, "first", result)
+	assert.Nil(t, err)
+}
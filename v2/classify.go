@@ -0,0 +1,83 @@
+package gobreaker
+
+import (
+	"errors"
+	"time"
+)
+
+// SuccessClassifier decides how a request executed by CircuitBreaker is counted
+// from the value and the error returned by the request and its latency.
+// The error is the one returned by NormalizeError if NormalizeError is set.
+type SuccessClassifier interface {
+	Classify(result any, err error, latency time.Duration) Outcome
+}
+
+// ClassifierFunc is an adapter to use an ordinary function as SuccessClassifier.
+type ClassifierFunc func(result any, err error, latency time.Duration) Outcome
+
+// Classify calls f(result, err, latency).
+func (f ClassifierFunc) Classify(result any, err error, latency time.Duration) Outcome {
+	return f(result, err, latency)
+}
+
+// ErrorClassifier returns a SuccessClassifier that counts a request as a success
+// if isSuccessful returns true for its error, or as a failure otherwise.
+// If isSuccessful is nil, only the requests returning a nil error are successes.
+func ErrorClassifier(isSuccessful func(err error) bool) SuccessClassifier {
+	if isSuccessful == nil {
+		isSuccessful = defaultIsSuccessful
+	}
+
+	return ClassifierFunc(func(_ any, err error, _ time.Duration) Outcome {
+		if !isSuccessful(err) {
+			return OutcomeFailure
+		}
+		return OutcomeSuccess
+	})
+}
+
+// LatencyClassifier returns a SuccessClassifier that classifies a request by next
+// but doesn't count a success faster than minLatency as a success.
+// Such a request is counted as a failure if fastAsFailure is true, or ignored otherwise.
+func LatencyClassifier(next SuccessClassifier, minLatency time.Duration, fastAsFailure bool) SuccessClassifier {
+	return ClassifierFunc(func(result any, err error, latency time.Duration) Outcome {
+		o := next.Classify(result, err, latency)
+		if o != OutcomeSuccess || latency >= minLatency {
+			return o
+		}
+
+		if fastAsFailure {
+			return OutcomeFailure
+		}
+		return OutcomeIgnore
+	})
+}
+
+// IgnoreErrorsClassifier returns a SuccessClassifier that ignores a request
+// whose error matches any of errs by errors.Is, and classifies the others by next.
+func IgnoreErrorsClassifier(next SuccessClassifier, errs ...error) SuccessClassifier {
+	return ClassifierFunc(func(result any, err error, latency time.Duration) Outcome {
+		if err != nil {
+			for _, target := range errs {
+				if errors.Is(err, target) {
+					return OutcomeIgnore
+				}
+			}
+		}
+		return next.Classify(result, err, latency)
+	})
+}
+
+func defaultIsSuccessful(err error) bool {
+	return err == nil
+}
+
+// defaultClassifier returns the SuccessClassifier built from IsSuccessful,
+// MinSuccessLatency and FastSuccessAsFailure of st.
+func defaultClassifier(st Settings) SuccessClassifier {
+	c := ErrorClassifier(st.IsSuccessful)
+	if st.MinSuccessLatency > 0 {
+		c = LatencyClassifier(c, st.MinSuccessLatency, st.FastSuccessAsFailure)
+	}
+	return c
+}
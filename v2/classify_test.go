@@ -0,0 +1,144 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker/v2/gobreakertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorClassifier(t *testing.T) {
+	c := ErrorClassifier(nil)
+	assert.Equal(t, OutcomeSuccess, c.Classify(nil, nil, 0))
+	assert.Equal(t, OutcomeFailure, c.Classify(nil, errors.New("fail"), 0))
+
+	c = ErrorClassifier(func(err error) bool { return err != context.Canceled })
+	assert.Equal(t, OutcomeSuccess, c.Classify(nil, errors.New("fail"), 0))
+	assert.Equal(t, OutcomeFailure, c.Classify(nil, context.Canceled, 0))
+}
+
+func TestLatencyClassifier(t *testing.T) {
+	c := LatencyClassifier(ErrorClassifier(nil), time.Second, false)
+	assert.Equal(t, OutcomeSuccess, c.Classify(nil, nil, time.Second))
+	assert.Equal(t, OutcomeIgnore, c.Classify(nil, nil, time.Millisecond))
+	assert.Equal(t, OutcomeFailure, c.Classify(nil, errors.New("fail"), time.Millisecond))
+
+	c = LatencyClassifier(ErrorClassifier(nil), time.Second, true)
+	assert.Equal(t, OutcomeFailure, c.Classify(nil, nil, time.Millisecond))
+}
+
+func TestIgnoreErrorsClassifier(t *testing.T) {
+	errIgnored := errors.New("ignored")
+	c := IgnoreErrorsClassifier(ErrorClassifier(nil), errIgnored, context.Canceled)
+	assert.Equal(t, OutcomeSuccess, c.Classify(nil, nil, 0))
+	assert.Equal(t, OutcomeIgnore, c.Classify(nil, fmt.Errorf("wrapped: %w", errIgnored), 0))
+	assert.Equal(t, OutcomeIgnore, c.Classify(nil, context.Canceled, 0))
+	assert.Equal(t, OutcomeFailure, c.Classify(nil, errors.New("fail"), 0))
+}
+
+func TestCustomSuccessClassifier(t *testing.T) {
+	var results []any
+	cb := NewCircuitBreaker[int](Settings{
+		SuccessClassifier: ClassifierFunc(func(result any, err error, _ time.Duration) Outcome {
+			results = append(results, result)
+			if result.(int) < 0 {
+				return OutcomeFailure
+			}
+			return OutcomeSuccess
+		}),
+	})
+
+	_, err := cb.Execute(func() (int, error) { return 1, nil })
+	assert.Nil(t, err)
+	_, err = cb.Execute(func() (int, error) { return -1, nil })
+	assert.Nil(t, err)
+	assert.Equal(t, []any{1, -1}, results)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0}, cb.Counts())
+}
+
+func TestIgnoreErrorsClassifierInHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		SuccessClassifier: IgnoreErrorsClassifier(ErrorClassifier(nil), context.Canceled),
+	})
+	cb.setState(StateHalfOpen, time.Now())
+
+	for i := 0; i < 3; i++ {
+		_, err := cb.Execute(func() (bool, error) { return false, context.Canceled })
+		assert.Equal(t, context.Canceled, err)
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestLatencyClassifierInHalfOpen(t *testing.T) {
+	clock := gobreakertest.NewClock(time.Now())
+	cb := NewCircuitBreaker[bool](Settings{
+		Clock:             clock,
+		SuccessClassifier: LatencyClassifier(ErrorClassifier(nil), time.Second, false),
+	})
+	cb.setState(StateHalfOpen, clock.Now())
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	_, err := cb.Execute(func() (bool, error) {
+		clock.Advance(time.Second)
+		return true, nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestClassifyError(t *testing.T) {
+	errIgnored := errors.New("ignored")
+	errBenign := errors.New("benign")
+	errTimeout := errors.New("upstream timeout")
+	cb := NewCircuitBreaker[bool](Settings{
+		SuccessClassifier: IgnoreErrorsClassifier(
+			ErrorClassifier(func(err error) bool { return err == nil || errors.Is(err, errBenign) }),
+			errIgnored, context.Canceled),
+		NormalizeError: func(err error) error {
+			if err == errTimeout {
+				return context.DeadlineExceeded
+			}
+			return err
+		},
+		ReadyToTrip: func(Counts) bool { return false },
+	})
+
+	tests := []struct {
+		err  error
+		want Outcome
+	}{
+		{nil, OutcomeSuccess},
+		{errBenign, OutcomeSuccess},
+		{fmt.Errorf("wrapped: %w", errIgnored), OutcomeIgnore},
+		{context.Canceled, OutcomeIgnore},
+		{errTimeout, OutcomeFailure},
+		{errors.New("fail"), OutcomeFailure},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, cb.ClassifyError(tt.err), tt.err)
+
+		before := cb.Counts()
+		_, _ = cb.Execute(func() (bool, error) { return false, tt.err })
+		after := cb.Counts()
+		got := OutcomeIgnore
+		if after.TotalSuccesses > before.TotalSuccesses {
+			got = OutcomeSuccess
+		} else if after.TotalFailures > before.TotalFailures {
+			got = OutcomeFailure
+		}
+		assert.Equal(t, got, cb.ClassifyError(tt.err), tt.err)
+	}
+}
@@ -15,8 +15,7 @@ func init() {
 	var st gobreaker.Settings
 	st.Name = "HTTP GET"
 	st.ReadyToTrip = func(counts gobreaker.Counts) bool {
-		failureRatio := float64(counts.TotalFailures) / float64(counts.Requests)
-		return counts.Requests >= 3 && failureRatio >= 0.6
+		return counts.Requests >= 3 && counts.FailureRatio() >= 0.6
 	}
 
 	cb = gobreaker.NewCircuitBreaker[[]byte](st)
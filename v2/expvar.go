@@ -0,0 +1,63 @@
+package gobreaker
+
+import (
+	"errors"
+	"expvar"
+	"sync"
+)
+
+// ExpvarName is the name of the expvar.Map in which PublishExpvar publishes the CircuitBreakers.
+const ExpvarName = "gobreaker"
+
+// ErrExpvarDuplicate is returned by PublishExpvar when a CircuitBreaker of the same name is already published
+var ErrExpvarDuplicate = errors.New("expvar: duplicate name")
+
+// ErrExpvarConflict is returned by PublishExpvar when ExpvarName is taken by another expvar.Var
+var ErrExpvarConflict = errors.New("expvar: name conflict")
+
+var (
+	expvarMutex sync.Mutex
+	expvarMap   *expvar.Map
+)
+
+// expvarStats is the value of a CircuitBreaker published in expvar.
+type expvarStats struct {
+	State   State   `json:"state"`
+	Counts  Counts  `json:"counts"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// publishExpvar publishes f under name in the expvar.Map of ExpvarName,
+// which is published on the first call.
+func publishExpvar(name string, f func() any) error {
+	expvarMutex.Lock()
+	defer expvarMutex.Unlock()
+
+	if expvarMap == nil {
+		if expvar.Get(ExpvarName) != nil {
+			return ErrExpvarConflict
+		}
+		expvarMap = expvar.NewMap(ExpvarName)
+	}
+	if expvarMap.Get(name) != nil {
+		return ErrExpvarDuplicate
+	}
+	expvarMap.Set(name, expvar.Func(f))
+	return nil
+}
+
+// PublishExpvar publishes the state, the internal Counts and the Metrics of the CircuitBreaker
+// under its name in the expvar.Map of ExpvarName, served on /debug/vars by the expvar package.
+// PublishExpvar returns ErrExpvarDuplicate if a CircuitBreaker of the same name is already published,
+// and ErrExpvarConflict if ExpvarName is taken by another expvar.Var.
+// Since expvar has no way to unpublish, the CircuitBreaker stays published for the life of the process.
+func (cb *CircuitBreaker[T]) PublishExpvar() error {
+	return publishExpvar(cb.name, func() any {
+		return expvarStats{State: cb.State(), Counts: cb.Counts(), Metrics: cb.Metrics()}
+	})
+}
+
+// PublishExpvar publishes the TwoStepCircuitBreaker in expvar as CircuitBreaker.PublishExpvar does.
+func (tscb *TwoStepCircuitBreaker[T]) PublishExpvar() error {
+	return tscb.cb.PublishExpvar()
+}
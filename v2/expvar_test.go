@@ -0,0 +1,54 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// expvarRuns numbers the runs of the tests publishing in the process-global expvar,
+// so that their names are unique under -count.
+var expvarRuns atomic.Uint64
+
+// expvarName returns a name for t unique in the process.
+func expvarName(t *testing.T) string {
+	return fmt.Sprintf("%s-%d", t.Name(), expvarRuns.Add(1))
+}
+
+func TestPublishExpvar(t *testing.T) {
+	name := expvarName(t)
+	cb := NewCircuitBreaker[bool](Settings{Name: name})
+	assert.Nil(t, cb.PublishExpvar())
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+
+	m, ok := expvar.Get(ExpvarName).(*expvar.Map)
+	assert.True(t, ok)
+	v := m.Get(name)
+	assert.NotNil(t, v)
+
+	var stats expvarStats
+	assert.Nil(t, json.Unmarshal([]byte(v.String()), &stats))
+	assert.Equal(t, StateClosed, stats.State)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0}, stats.Counts)
+	assert.Equal(t, uint64(2), stats.Metrics.Requests)
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, ErrOpenState, succeed(cb))
+	assert.Nil(t, json.Unmarshal([]byte(v.String()), &stats))
+	assert.Equal(t, StateOpen, stats.State)
+	assert.Equal(t, uint64(1), stats.Metrics.Rejections)
+
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Name: name})
+	assert.Equal(t, ErrExpvarDuplicate, tscb.PublishExpvar())
+	name2 := expvarName(t)
+	tscb = NewTwoStepCircuitBreaker[bool](Settings{Name: name2})
+	assert.Nil(t, tscb.PublishExpvar())
+	assert.NotNil(t, m.Get(name2))
+}
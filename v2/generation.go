@@ -0,0 +1,46 @@
+package gobreaker
+
+import "time"
+
+// maxGenerationRecords is the number of the recent generations CircuitBreaker keeps records of.
+const maxGenerationRecords = 32
+
+// GenerationRecord describes a generation of CircuitBreaker that has ended.
+// A generation ends on the change of the state, at the closed-state intervals, or on Reset.
+// State is the state in which the generation started, and Next is the state in which the next one started.
+type GenerationRecord struct {
+	State    State
+	Next     State
+	Start    time.Time
+	Duration time.Duration
+}
+
+// generationRecords keeps the records of the recent generations up to maxGenerationRecords.
+type generationRecords struct {
+	start   time.Time
+	state   State
+	records []GenerationRecord
+}
+
+// onNewGeneration records the generation that ends at now, if any, and starts a new one in state.
+func (g *generationRecords) onNewGeneration(state State, now time.Time) {
+	if !g.start.IsZero() {
+		if len(g.records) == maxGenerationRecords {
+			copy(g.records, g.records[1:])
+			g.records = g.records[:maxGenerationRecords-1]
+		}
+		g.records = append(g.records, GenerationRecord{
+			State:    g.state,
+			Next:     state,
+			Start:    g.start,
+			Duration: now.Sub(g.start),
+		})
+	}
+
+	g.start = now
+	g.state = state
+}
+
+func (g *generationRecords) snapshot() []GenerationRecord {
+	return append([]GenerationRecord(nil), g.records...)
+}
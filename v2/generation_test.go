@@ -0,0 +1,50 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerationStats(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	assert.Empty(t, cb.GenerationStats())
+
+	// StateClosed to StateOpen after 10 seconds
+	start := cb.generations.start
+	cb.generations.start = start.Add(-time.Duration(10) * time.Second)
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	stats := cb.GenerationStats()
+	assert.Equal(t, 1, len(stats))
+	assert.Equal(t, StateClosed, stats[0].State)
+	assert.Equal(t, StateOpen, stats[0].Next)
+	assert.Equal(t, start.Add(-time.Duration(10)*time.Second), stats[0].Start)
+	assert.True(t, stats[0].Duration >= time.Duration(10)*time.Second)
+
+	// StateOpen to StateHalfOpen to StateClosed
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	cb.generations.start = cb.generations.start.Add(-time.Duration(60) * time.Second)
+	assert.Nil(t, succeed(cb))
+	stats = cb.GenerationStats()
+	assert.Equal(t, 3, len(stats))
+	assert.Equal(t, StateOpen, stats[1].State)
+	assert.Equal(t, StateHalfOpen, stats[1].Next)
+	assert.True(t, stats[1].Duration >= time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, stats[2].State)
+	assert.Equal(t, StateClosed, stats[2].Next)
+	assert.True(t, stats[2].Duration < time.Second)
+
+	// the records are capped
+	for i := 0; i < maxGenerationRecords; i++ {
+		cb.Reset()
+	}
+	stats = cb.GenerationStats()
+	assert.Equal(t, maxGenerationRecords, len(stats))
+	for _, record := range stats {
+		assert.Equal(t, StateClosed, record.State)
+		assert.Equal(t, StateClosed, record.Next)
+	}
+}
@@ -3,8 +3,15 @@
 package gobreaker
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
 	"sync"
 	"time"
 )
@@ -17,6 +24,7 @@ const (
 	StateClosed State = iota
 	StateHalfOpen
 	StateOpen
+	StateDegraded
 )
 
 var (
@@ -24,8 +32,31 @@ var (
 	ErrTooManyRequests = errors.New("too many requests")
 	// ErrOpenState is returned when the CB state is open
 	ErrOpenState = errors.New("circuit breaker is open")
+	// ErrRateLimited is returned when the CB state is closed or degraded and the requests are over the cb rateLimit
+	ErrRateLimited = errors.New("rate limited")
+	// ErrNilRequest is returned when the request passed to Execute is nil
+	ErrNilRequest = errors.New("nil request")
+	// ErrLowPriority is returned when the CB state is half open or degraded and the request priority is under the cb sheddingMinPriority
+	ErrLowPriority = errors.New("low priority")
+	// ErrBulkheadFull is returned when all the cb maxConcurrent slots are taken for longer than the cb maxWait
+	ErrBulkheadFull = errors.New("bulkhead full")
+	// ErrDeadlineTooShort is returned when the remaining time until the deadline of the request context is under the cb minRemainingDeadline
+	ErrDeadlineTooShort = errors.New("deadline too short")
 )
 
+// IsBreakerError reports whether err, or any error it wraps, originates in CircuitBreaker
+// rather than in a request.
+func IsBreakerError(err error) bool {
+	return errors.Is(err, ErrTooManyRequests) ||
+		errors.Is(err, ErrOpenState) ||
+		errors.Is(err, ErrRateLimited) ||
+		errors.Is(err, ErrNilRequest) ||
+		errors.Is(err, ErrLowPriority) ||
+		errors.Is(err, ErrBulkheadFull) ||
+		errors.Is(err, ErrDeadlineTooShort) ||
+		errors.Is(err, ErrMaintenance)
+}
+
 // String implements stringer interface.
 func (s State) String() string {
 	switch s {
@@ -35,11 +66,75 @@ func (s State) String() string {
 		return "half-open"
 	case StateOpen:
 		return "open"
+	case StateDegraded:
+		return "degraded"
 	default:
 		return fmt.Sprintf("unknown state: %d", s)
 	}
 }
 
+// LoadShed reports whether r is a reason of shedding load to protect the CircuitBreaker from saturation,
+// i.e. RejectRateLimited, RejectLowPriority or RejectBulkheadFull,
+// rather than of failures of the dependency, such as RejectOpen and RejectTooManyRequests.
+func (r RejectReason) LoadShed() bool {
+	return r == RejectRateLimited || r == RejectLowPriority || r == RejectBulkheadFull
+}
+
+// closed reports whether s is either closed or degraded,
+// in which the CircuitBreaker admits requests without limiting their number.
+func (s State) closed() bool {
+	return s == StateClosed || s == StateDegraded
+}
+
+// RejectReason is a type that represents a reason why CircuitBreaker rejects a request.
+type RejectReason int
+
+// These constants are reasons why CircuitBreaker rejects a request.
+const (
+	RejectOpen RejectReason = iota
+	RejectTooManyRequests
+	RejectRateLimited
+	RejectLowPriority
+	RejectBulkheadFull
+	RejectDeadlineTooShort
+	RejectMaintenance
+)
+
+// String implements stringer interface.
+// The returned strings are suitable for metrics labels.
+func (r RejectReason) String() string {
+	switch r {
+	case RejectOpen:
+		return "open"
+	case RejectTooManyRequests:
+		return "too_many_requests"
+	case RejectRateLimited:
+		return "rate_limited"
+	case RejectLowPriority:
+		return "low_priority"
+	case RejectBulkheadFull:
+		return "bulkhead_full"
+	case RejectDeadlineTooShort:
+		return "deadline_too_short"
+	case RejectMaintenance:
+		return "maintenance"
+	default:
+		return fmt.Sprintf("unknown reason: %d", r)
+	}
+}
+
+// Outcome is a type that represents how the result of a request is counted.
+type Outcome int
+
+// These constants are outcomes of a request.
+// OutcomeIgnore counts the request as neither a success nor a failure.
+// In the half-open state, an ignored request gives back its slot of MaxRequests.
+const (
+	OutcomeSuccess Outcome = iota
+	OutcomeFailure
+	OutcomeIgnore
+)
+
 // Counts holds the numbers of requests and their successes/failures.
 // CircuitBreaker clears the internal Counts either
 // on the change of the state or at the closed-state intervals.
@@ -50,6 +145,25 @@ type Counts struct {
 	TotalFailures        uint32
 	ConsecutiveSuccesses uint32
 	ConsecutiveFailures  uint32
+	ConsecutiveTimeouts  uint32
+}
+
+// FailureRatio returns the ratio of TotalFailures to Requests, or 0 if there are no requests.
+// Requests include the requests in flight and the ignored ones.
+func (c Counts) FailureRatio() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.TotalFailures) / float64(c.Requests)
+}
+
+// SuccessRatio returns the ratio of TotalSuccesses to Requests, or 0 if there are no requests.
+// Requests include the requests in flight and the ignored ones.
+func (c Counts) SuccessRatio() float64 {
+	if c.Requests == 0 {
+		return 0
+	}
+	return float64(c.TotalSuccesses) / float64(c.Requests)
 }
 
 func (c *Counts) onRequest() {
@@ -60,12 +174,18 @@ func (c *Counts) onSuccess() {
 	c.TotalSuccesses++
 	c.ConsecutiveSuccesses++
 	c.ConsecutiveFailures = 0
+	c.ConsecutiveTimeouts = 0
 }
 
-func (c *Counts) onFailure() {
+func (c *Counts) onFailure(timeout bool) {
 	c.TotalFailures++
 	c.ConsecutiveFailures++
 	c.ConsecutiveSuccesses = 0
+	if timeout {
+		c.ConsecutiveTimeouts++
+	} else {
+		c.ConsecutiveTimeouts = 0
+	}
 }
 
 func (c *Counts) clear() {
@@ -74,6 +194,7 @@ func (c *Counts) clear() {
 	c.TotalFailures = 0
 	c.ConsecutiveSuccesses = 0
 	c.ConsecutiveFailures = 0
+	c.ConsecutiveTimeouts = 0
 }
 
 // Settings configures CircuitBreaker:
@@ -83,6 +204,8 @@ func (c *Counts) clear() {
 // MaxRequests is the maximum number of requests allowed to pass through
 // when the CircuitBreaker is half-open.
 // If MaxRequests is 0, the CircuitBreaker allows only 1 request.
+// If any of these requests fails, the CircuitBreaker is placed into the open state at once
+// and the outcomes of the other requests admitted in the same half-open state are ignored.
 //
 // Interval is the cyclic period of the closed state
 // for the CircuitBreaker to clear the internal Counts.
@@ -103,31 +226,369 @@ func (c *Counts) clear() {
 // If IsSuccessful returns true, the error is counted as a success.
 // Otherwise the error is counted as a failure.
 // If IsSuccessful is nil, default IsSuccessful is used, which returns false for all non-nil errors.
+//
+// RateLimit is the maximum number of requests per second allowed to pass through
+// when the CircuitBreaker is closed or degraded. The requests over the limit are rejected with ErrRateLimited
+// and are not counted in Counts.
+// If RateLimit is less than or equal to 0, the CircuitBreaker doesn't limit the request rate.
+//
+// RateBurst is the maximum number of requests allowed to pass through at once under RateLimit.
+// If RateBurst is 0, the CircuitBreaker allows a burst of only 1 request.
+//
+// NormalizeError is called with the error returned from a request before IsSuccessful.
+// The error returned by NormalizeError is classified by IsSuccessful and returned to the caller
+// in place of the original error.
+// If NormalizeError is nil, the original error is used as it is.
+//
+// WarmupPeriod is the period after the creation of the CircuitBreaker
+// during which ReadyToTrip is not called and the CircuitBreaker stays closed regardless of failures.
+// If WarmupPeriod is less than or equal to 0, the CircuitBreaker has no warm-up period.
+//
+// OnReject is called with the reason whenever the CircuitBreaker rejects a request.
+//
+// OnAllow is called with the state and the generation at the admission
+// whenever the CircuitBreaker accepts a request.
+//
+// ReadyToDegrade is called with a copy of Counts whenever a request fails in the closed state
+// and ReadyToTrip returns false.
+// If ReadyToDegrade returns true, the CircuitBreaker will be placed into the degraded state,
+// in which requests are still allowed to pass through.
+// In the degraded state, ReadyToDegrade is also called whenever a request succeeds,
+// and the CircuitBreaker will be placed back into the closed state if it returns false.
+// Moving between the closed and the degraded states doesn't clear the internal Counts.
+// If ReadyToDegrade is nil, the CircuitBreaker never becomes degraded.
+//
+// MinHalfOpenDuration is the minimum period of the half-open state.
+// The CircuitBreaker is placed into the closed state only after both
+// MaxRequests consecutive successes and MinHalfOpenDuration since it became half-open.
+// If MinHalfOpenDuration is less than or equal to 0, the CircuitBreaker closes as soon as enough requests succeed.
+//
+// HalfOpenSlotTimeout is the period after the last admission in the half-open state
+// after which the requests that haven't reported the outcome are regarded as abandoned
+// if MaxRequests is used up.
+// Then the CircuitBreaker starts the half-open state over and ignores the outcomes of the abandoned requests.
+// If HalfOpenSlotTimeout is less than or equal to 0, the admitted requests are never regarded as abandoned.
+//
+// MinSuccessLatency is the minimum latency of a request executed by Execute to be counted as a success.
+// It is meant for dependencies that fail fast while reporting success, e.g. by serving a cached error page.
+// A successful request faster than MinSuccessLatency is not counted as a success;
+// it is counted as a failure if FastSuccessAsFailure is true, or not counted at all otherwise.
+// If MinSuccessLatency is less than or equal to 0, the latency of requests is not checked.
+//
+// SuccessClassifier decides how a request executed by Execute is counted
+// from its value, error and latency.
+// If SuccessClassifier is set, IsSuccessful, MinSuccessLatency and FastSuccessAsFailure are not used.
+// If SuccessClassifier is nil, the classifier built from them is used.
+//
+// ManualResetOnly makes the CircuitBreaker stay in the open state after Timeout
+// until Reset is called, instead of becoming half-open.
+//
+// LastSuccessTTL is the period for which the CircuitBreaker keeps the result of the last successful request
+// executed by Execute, to be served by ExecuteWithStale while the CircuitBreaker is open.
+// If LastSuccessTTL is less than or equal to 0, the CircuitBreaker doesn't keep the result.
+//
+// SheddingMinPriority is the minimum priority of requests allowed to pass through
+// when the CircuitBreaker is half-open or degraded.
+// The requests under the priority are rejected with ErrLowPriority.
+// Execute and TwoStepCircuitBreaker.Allow send requests with priority 0, and ExecutePriority with a given priority.
+// The priority is a fixed cut-off regardless of the remaining MaxRequests.
+// Since the half-open state has no expiry, a CircuitBreaker that receives only requests under the priority
+// stays half-open until a request of the priority arrives, or until Reset is called.
+// If SheddingMinPriority is less than or equal to 0, requests of priority 0 are never rejected for their priority.
+//
+// MaxTimeout is the maximum period of the open state when a request fails in the half-open state.
+// Each time a request fails in the half-open state, the period of the following open state is doubled,
+// starting from Timeout, up to MaxTimeout. It is reset to Timeout when the CircuitBreaker becomes closed.
+// If MaxTimeout is less than or equal to Timeout, the period of the open state is always Timeout.
+//
+// IsTimeout is called with the error of a failed request.
+// If IsTimeout returns true, the failure is counted in Counts.ConsecutiveTimeouts as well.
+// If IsTimeout is nil, default IsTimeout is used, which returns true for context.DeadlineExceeded,
+// os.ErrDeadlineExceeded and net.Error timeouts.
+//
+// OnApproachingTrip is called with a copy of Counts and the progress toward tripping
+// when the progress reaches TripWarningFraction on a failure that doesn't trip the CircuitBreaker.
+// It is called at most once until the internal Counts is cleared.
+//
+// TripProgress is called with a copy of Counts to compute the progress toward tripping,
+// where 1 means that ReadyToTrip returns true.
+// If TripProgress is nil and ReadyToTrip is nil, the progress of default ReadyToTrip is used,
+// which is the number of consecutive failures divided by 6.
+// If TripProgress is nil and ReadyToTrip is not nil, OnApproachingTrip is never called.
+//
+// TripWarningFraction is the progress at which OnApproachingTrip is called.
+// If TripWarningFraction is less than or equal to 0, the fraction is set to 0.8.
+//
+// Clock is the source of the current time for the CircuitBreaker.
+// If Clock is nil, the system clock is used.
+// Tests can set a fake clock, such as gobreakertest.Clock, to advance time without sleeping.
+//
+// MaxConcurrent is the maximum number of requests executed by Execute at the same time.
+// A request over the limit waits up to MaxWait for another request to finish
+// and is rejected with ErrBulkheadFull if none finishes in time.
+// The bulkhead is local to the CircuitBreaker, and the rejected requests are not counted in Counts.
+// If MaxConcurrent is 0, the CircuitBreaker doesn't limit the concurrency.
+//
+// MaxWait is the maximum period for which a request waits for a slot under MaxConcurrent.
+// If MaxWait is less than or equal to 0, a request over MaxConcurrent is rejected at once.
+//
+// CorrelationIDKey is the key of the context value that holds the correlation ID,
+// such as a trace ID, of a request executed by ExecuteContext.
+// The value is formatted by fmt.Sprint unless it is a string.
+//
+// OnStateChangeWithID is called whenever the state of the CircuitBreaker changes, as OnStateChange is,
+// with the correlation ID of the request that caused the change.
+// The correlation ID is empty if the change isn't caused by a request with one.
+//
+// ProbeFunc is a synthetic request that tests the recovery of the dependency in place of real requests.
+// If ProbeFunc is set, the CircuitBreaker rejects all the requests in the half-open state with ErrTooManyRequests
+// and runs ProbeFunc in a new goroutine when it becomes half-open,
+// which happens on the first use of the CircuitBreaker after Timeout, or after MaxTimeout with backoff,
+// or after ProbeSchedule in the background.
+// If ProbeFunc returns nil, the CircuitBreaker is placed into the closed state, or the open state otherwise.
+// The probes are not counted in Counts.
+// A panic in ProbeFunc is recovered and counted as a failed probe.
+//
+// ProbeTimeout is the deadline of the context passed to ProbeFunc.
+// If ProbeTimeout is less than or equal to 0, the context has no deadline.
+//
+// MinRemainingDeadline is the minimum remaining time until the deadline of the context
+// of a request executed by ExecuteContext.
+// A request with less time left is rejected with ErrDeadlineTooShort without being counted in Counts.
+// The remaining time is measured by the system clock, not Clock, as the deadlines of contexts are.
+// If MinRemainingDeadline is less than or equal to 0, the deadline of requests is not checked.
+//
+// EventTimelineSize is the number of the recent events, such as admissions, rejections, outcomes and
+// state changes, that the CircuitBreaker records for debugging and EventTimeline returns.
+// If EventTimelineSize is less than or equal to 0, the CircuitBreaker doesn't record events.
+//
+// RetryableClassifier is called with the non-nil error returned from a request executed by Execute
+// to judge whether the request can be retried.
+// If RetryableClassifier is set, Execute returns the error wrapped with the judgement for IsRetryable,
+// which errors.Is and errors.As see through.
+// If RetryableClassifier is nil, the error is returned as it is.
+// DefaultRetryableClassifier judges only timeouts retryable.
+//
+// OnStateChangeMinInterval is the minimum interval between the calls of OnStateChange and OnStateChangeWithID
+// for the same transition, e.g. from closed to open.
+// The transitions within the interval since the last call for the same transition are coalesced,
+// while the state of the CircuitBreaker changes as usual:
+// once the interval has passed, the next use of the CircuitBreaker notifies a single transition
+// from the last notified state to the current state, unless they are the same.
+// If OnStateChangeMinInterval is less than or equal to 0, every transition is notified.
+//
+// HealthyLatencyThreshold is the maximum latency of a successful request executed by Execute
+// in the half-open state to count toward closing the CircuitBreaker.
+// A slower success starts the half-open state over, so that the CircuitBreaker closes
+// only after MaxRequests consecutive successes within HealthyLatencyThreshold.
+// If HealthyLatencyThreshold is less than or equal to 0, the latency of successes is not checked.
+//
+// Logger receives a structured record of every state change, with the name, the states before and after,
+// the new generation and the Counts of the ended generation,
+// and of every administrative action such as Reset, UpdateSettings, LoadState and maintenance mode.
+// A record caused by a request with a correlation ID has it as the correlation_id attribute.
+// Unlike OnStateChange, the records are not affected by OnStateChangeMinInterval.
+// If Logger is nil, the CircuitBreaker doesn't log.
+//
+// OnLoadShed is called with the reason, in addition to OnReject,
+// whenever the CircuitBreaker rejects a request for a reason of load shedding as RejectReason.LoadShed reports.
+//
+// FailOpenOn is called with the non-nil error returned from a request.
+// If FailOpenOn returns true, the CircuitBreaker fails open: it admits all requests regardless of the state,
+// except in maintenance mode, and stops counting their outcomes, so that it never trips.
+// Failing open is sticky; the CircuitBreaker keeps failing open until Reset is called.
+//
+// RecoverPanics makes Execute recover a panic in a request and return it as a PanicError,
+// which errors.Is reports as ErrPanic, instead of panicking again.
+// Either way, the panicked request is counted as a failure.
+//
+// ProbeSchedule is the interval at which the CircuitBreaker runs ProbeFunc in the background while it is open.
+// ProbeSchedule after being placed into the open state, the CircuitBreaker becomes half-open and runs ProbeFunc
+// without waiting for Timeout or for a use of the CircuitBreaker, so that an idle CircuitBreaker recovers by itself.
+// If ProbeSchedule is less than or equal to 0, ProbeFunc runs only on a use of the CircuitBreaker after Timeout.
+//
+// OnRejectWithID is called whenever the CircuitBreaker rejects a request, as OnReject is,
+// with the correlation ID of the rejected request.
+// The correlation ID is empty if the request doesn't have one.
 type Settings struct {
-	Name          string
-	MaxRequests   uint32
-	Interval      time.Duration
-	Timeout       time.Duration
-	ReadyToTrip   func(counts Counts) bool
-	OnStateChange func(name string, from State, to State)
-	IsSuccessful  func(err error) bool
+	Name                     string
+	MaxRequests              uint32
+	Interval                 time.Duration
+	Timeout                  time.Duration
+	ReadyToTrip              func(counts Counts) bool
+	OnStateChange            func(name string, from State, to State)
+	IsSuccessful             func(err error) bool
+	RateLimit                float64
+	RateBurst                uint32
+	NormalizeError           func(err error) error
+	WarmupPeriod             time.Duration
+	OnReject                 func(name string, reason RejectReason)
+	ReadyToDegrade           func(counts Counts) bool
+	MinHalfOpenDuration      time.Duration
+	HalfOpenSlotTimeout      time.Duration
+	MinSuccessLatency        time.Duration
+	FastSuccessAsFailure     bool
+	ManualResetOnly          bool
+	LastSuccessTTL           time.Duration
+	SheddingMinPriority      int
+	MaxTimeout               time.Duration
+	IsTimeout                func(err error) bool
+	OnApproachingTrip        func(name string, counts Counts, fraction float64)
+	TripProgress             func(counts Counts) float64
+	TripWarningFraction      float64
+	OnAllow                  func(name string, state State, generation uint64)
+	Clock                    Clock
+	SuccessClassifier        SuccessClassifier
+	MaxConcurrent            uint32
+	MaxWait                  time.Duration
+	CorrelationIDKey         any
+	OnStateChangeWithID      func(name string, from State, to State, correlationID string)
+	ProbeFunc                func(ctx context.Context) error
+	ProbeTimeout             time.Duration
+	MinRemainingDeadline     time.Duration
+	EventTimelineSize        int
+	RetryableClassifier      func(err error) bool
+	OnStateChangeMinInterval time.Duration
+	HealthyLatencyThreshold  time.Duration
+	Logger                   *slog.Logger
+	OnLoadShed               func(name string, reason RejectReason)
+	FailOpenOn               func(err error) bool
+	RecoverPanics            bool
+	ProbeSchedule            time.Duration
+	OnRejectWithID           func(name string, reason RejectReason, correlationID string)
+}
+
+// Clock is an interface that provides the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// Validate checks the sanity of the Settings and returns all the problems found joined into one error.
+// It returns nil if the Settings are valid.
+// NewCircuitBreaker doesn't call Validate and accepts any Settings, falling back to the defaults.
+func (st Settings) Validate() error {
+	var errs []error
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"Interval", st.Interval},
+		{"Timeout", st.Timeout},
+		{"WarmupPeriod", st.WarmupPeriod},
+		{"MinHalfOpenDuration", st.MinHalfOpenDuration},
+		{"HalfOpenSlotTimeout", st.HalfOpenSlotTimeout},
+		{"MinSuccessLatency", st.MinSuccessLatency},
+		{"MaxTimeout", st.MaxTimeout},
+		{"LastSuccessTTL", st.LastSuccessTTL},
+		{"MaxWait", st.MaxWait},
+		{"ProbeTimeout", st.ProbeTimeout},
+		{"ProbeSchedule", st.ProbeSchedule},
+		{"MinRemainingDeadline", st.MinRemainingDeadline},
+		{"OnStateChangeMinInterval", st.OnStateChangeMinInterval},
+		{"HealthyLatencyThreshold", st.HealthyLatencyThreshold},
+	}
+	for _, d := range durations {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("negative %s: %v", d.name, d.value))
+		}
+	}
+
+	if st.RateLimit < 0 || math.IsNaN(st.RateLimit) || math.IsInf(st.RateLimit, 0) {
+		errs = append(errs, fmt.Errorf("invalid RateLimit: %v", st.RateLimit))
+	}
+	if st.RateBurst > 0 && st.RateLimit == 0 {
+		errs = append(errs, errors.New("RateBurst without RateLimit"))
+	}
+	if st.TripWarningFraction < 0 || math.IsNaN(st.TripWarningFraction) {
+		errs = append(errs, fmt.Errorf("invalid TripWarningFraction: %v", st.TripWarningFraction))
+	}
+	if st.FastSuccessAsFailure && st.MinSuccessLatency == 0 {
+		errs = append(errs, errors.New("FastSuccessAsFailure without MinSuccessLatency"))
+	}
+	if st.SuccessClassifier != nil && (st.IsSuccessful != nil || st.MinSuccessLatency != 0) {
+		errs = append(errs, errors.New("SuccessClassifier with IsSuccessful or MinSuccessLatency"))
+	}
+	if st.MaxWait > 0 && st.MaxConcurrent == 0 {
+		errs = append(errs, errors.New("MaxWait without MaxConcurrent"))
+	}
+	if st.ProbeSchedule > 0 && st.ProbeFunc == nil {
+		errs = append(errs, errors.New("ProbeSchedule without ProbeFunc"))
+	}
+
+	return errors.Join(errs...)
 }
 
 // CircuitBreaker is a state machine to prevent sending requests that are likely to fail.
 type CircuitBreaker[T any] struct {
-	name          string
-	maxRequests   uint32
-	interval      time.Duration
-	timeout       time.Duration
-	readyToTrip   func(counts Counts) bool
-	isSuccessful  func(err error) bool
-	onStateChange func(name string, from State, to State)
+	name                 string
+	maxRequests          uint32
+	interval             time.Duration
+	timeout              time.Duration
+	readyToTrip          func(counts Counts) bool
+	classifier           SuccessClassifier
+	onStateChange        func(name string, from State, to State)
+	normalizeError       func(err error) error
+	onReject             func(name string, reason RejectReason)
+	onRejectWithID       func(name string, reason RejectReason, correlationID string)
+	onLoadShed           func(name string, reason RejectReason)
+	failOpenOn           func(err error) bool
+	recoverPanics        bool
+	readyToDegrade       func(counts Counts) bool
+	warmupEnd            time.Time
+	minHalfOpenDuration  time.Duration
+	halfOpenSlotTimeout  time.Duration
+	manualResetOnly      bool
+	lastSuccessTTL       time.Duration
+	sheddingMinPriority  int
+	maxTimeout           time.Duration
+	isTimeout            func(err error) bool
+	onApproachingTrip    func(name string, counts Counts, fraction float64)
+	tripProgress         func(counts Counts) float64
+	tripWarningFraction  float64
+	onAllow              func(name string, state State, generation uint64)
+	clock                Clock
+	bulkhead             *bulkhead
+	correlationIDKey     any
+	onStateChangeWithID  func(name string, from State, to State, correlationID string)
+	probeFunc            func(ctx context.Context) error
+	probeTimeout         time.Duration
+	probeSchedule        time.Duration
+	minRemainingDeadline time.Duration
+	timeline             *eventTimeline
+	retryableClassifier  func(err error) bool
+	notifyMinInterval    time.Duration
+	healthyLatency       time.Duration
+	logger               *slog.Logger
+
+	mutex         sync.Mutex
+	state         State
+	generation    uint64
+	counts        Counts
+	expiry        time.Time
+	lifetime      Counts
+	lastTripErr   error
+	limiter       *tokenBucket
+	halfOpenSince time.Time
+	lastAdmitted  time.Time
+	lastSuccess   T
+	lastSuccessAt time.Time
+	backoff       uint
+	generations   generationRecords
+	tripWarned    bool
+	cause         string
+	maintenance   *MaintenanceError
+	failOpen      bool
+	notified      map[[2]State]time.Time
+	pending       bool
+	notifiedState State
 
-	mutex      sync.Mutex
-	state      State
-	generation uint64
-	counts     Counts
-	expiry     time.Time
+	metrics metrics
+	flights flightGroup[T]
 }
 
 // TwoStepCircuitBreaker is like CircuitBreaker but instead of surrounding a function
@@ -143,7 +604,114 @@ func NewCircuitBreaker[T any](st Settings) *CircuitBreaker[T] {
 
 	cb.name = st.Name
 	cb.onStateChange = st.OnStateChange
+	cb.normalizeError = st.NormalizeError
+	cb.onReject = st.OnReject
+	cb.onRejectWithID = st.OnRejectWithID
+	cb.onLoadShed = st.OnLoadShed
+	cb.failOpenOn = st.FailOpenOn
+	cb.recoverPanics = st.RecoverPanics
+	cb.onAllow = st.OnAllow
+	cb.correlationIDKey = st.CorrelationIDKey
+	cb.onStateChangeWithID = st.OnStateChangeWithID
+	cb.probeFunc = st.ProbeFunc
+	cb.retryableClassifier = st.RetryableClassifier
+	cb.logger = st.Logger
+	if st.OnStateChangeMinInterval > 0 {
+		cb.notifyMinInterval = st.OnStateChangeMinInterval
+	}
+	if st.HealthyLatencyThreshold > 0 {
+		cb.healthyLatency = st.HealthyLatencyThreshold
+	}
+	cb.readyToDegrade = st.ReadyToDegrade
+	cb.manualResetOnly = st.ManualResetOnly
+	cb.sheddingMinPriority = st.SheddingMinPriority
+
+	if st.MinHalfOpenDuration > 0 {
+		cb.minHalfOpenDuration = st.MinHalfOpenDuration
+	}
+
+	if st.HalfOpenSlotTimeout > 0 {
+		cb.halfOpenSlotTimeout = st.HalfOpenSlotTimeout
+	}
 
+	if st.LastSuccessTTL > 0 {
+		cb.lastSuccessTTL = st.LastSuccessTTL
+	}
+
+	if st.ProbeTimeout > 0 {
+		cb.probeTimeout = st.ProbeTimeout
+	}
+
+	if st.ProbeFunc != nil && st.ProbeSchedule > 0 {
+		cb.probeSchedule = st.ProbeSchedule
+	}
+
+	if st.MinRemainingDeadline > 0 {
+		cb.minRemainingDeadline = st.MinRemainingDeadline
+	}
+
+	if st.EventTimelineSize > 0 {
+		cb.timeline = newEventTimeline(st.EventTimelineSize)
+	}
+
+	cb.applyLimits(st)
+
+	if st.ReadyToTrip == nil {
+		cb.readyToTrip = defaultReadyToTrip
+	} else {
+		cb.readyToTrip = st.ReadyToTrip
+	}
+
+	if st.SuccessClassifier == nil {
+		cb.classifier = defaultClassifier(st)
+	} else {
+		cb.classifier = st.SuccessClassifier
+	}
+
+	cb.onApproachingTrip = st.OnApproachingTrip
+	if st.TripProgress == nil && st.ReadyToTrip == nil {
+		cb.tripProgress = defaultTripProgress
+	} else {
+		cb.tripProgress = st.TripProgress
+	}
+	if st.TripWarningFraction <= 0 {
+		cb.tripWarningFraction = defaultTripWarningFraction
+	} else {
+		cb.tripWarningFraction = st.TripWarningFraction
+	}
+
+	if st.IsTimeout == nil {
+		cb.isTimeout = defaultIsTimeout
+	} else {
+		cb.isTimeout = st.IsTimeout
+	}
+
+	if st.Clock == nil {
+		cb.clock = systemClock{}
+	} else {
+		cb.clock = st.Clock
+	}
+
+	now := cb.clock.Now()
+	if st.WarmupPeriod > 0 {
+		cb.warmupEnd = now.Add(st.WarmupPeriod)
+	}
+
+	if st.RateLimit > 0 {
+		cb.limiter = newTokenBucket(st.RateLimit, st.RateBurst, now)
+	}
+
+	if st.MaxConcurrent > 0 {
+		cb.bulkhead = newBulkhead(st.MaxConcurrent, st.MaxWait)
+	}
+
+	cb.toNewGeneration(now)
+
+	return cb
+}
+
+// applyLimits sets MaxRequests, Interval, Timeout and MaxTimeout of st, which can be updated by UpdateSettings.
+func (cb *CircuitBreaker[T]) applyLimits(st Settings) {
 	if st.MaxRequests == 0 {
 		cb.maxRequests = 1
 	} else {
@@ -162,21 +730,35 @@ func NewCircuitBreaker[T any](st Settings) *CircuitBreaker[T] {
 		cb.timeout = st.Timeout
 	}
 
-	if st.ReadyToTrip == nil {
-		cb.readyToTrip = defaultReadyToTrip
+	if st.MaxTimeout > cb.timeout {
+		cb.maxTimeout = st.MaxTimeout
 	} else {
-		cb.readyToTrip = st.ReadyToTrip
+		cb.maxTimeout = cb.timeout
 	}
+}
 
-	if st.IsSuccessful == nil {
-		cb.isSuccessful = defaultIsSuccessful
-	} else {
-		cb.isSuccessful = st.IsSuccessful
+// NewCircuitBreakerFromCaller is like NewCircuitBreaker but, if Name is empty,
+// names the CircuitBreaker after its call site in the form "function@file:line",
+// so that the CircuitBreakers created at different places get different names.
+func NewCircuitBreakerFromCaller[T any](st Settings) *CircuitBreaker[T] {
+	if st.Name == "" {
+		st.Name = callerName(1)
 	}
+	return NewCircuitBreaker[T](st)
+}
 
-	cb.toNewGeneration(time.Now())
+// callerName returns the name of the call site skip frames above the caller of callerName.
+func callerName(skip int) string {
+	pc, file, line, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ""
+	}
 
-	return cb
+	name := "unknown"
+	if fn := runtime.FuncForPC(pc); fn != nil {
+		name = fn.Name()
+	}
+	return fmt.Sprintf("%s@%s:%d", name, filepath.Base(file), line)
 }
 
 // NewTwoStepCircuitBreaker returns a new TwoStepCircuitBreaker configured with the given Settings.
@@ -189,12 +771,23 @@ func NewTwoStepCircuitBreaker[T any](st Settings) *TwoStepCircuitBreaker[T] {
 const defaultInterval = time.Duration(0) * time.Second
 const defaultTimeout = time.Duration(60) * time.Second
 
+const defaultTripWarningFraction = 0.8
+
 func defaultReadyToTrip(counts Counts) bool {
 	return counts.ConsecutiveFailures > 5
 }
 
-func defaultIsSuccessful(err error) bool {
-	return err == nil
+func defaultTripProgress(counts Counts) float64 {
+	return float64(counts.ConsecutiveFailures) / 6
+}
+
+func defaultIsTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
 }
 
 // Name returns the name of the CircuitBreaker.
@@ -207,7 +800,7 @@ func (cb *CircuitBreaker[T]) State() State {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	now := cb.clock.Now()
 	state, _ := cb.currentState(now)
 	return state
 }
@@ -220,13 +813,213 @@ func (cb *CircuitBreaker[T]) Counts() Counts {
 	return cb.counts
 }
 
+// LifetimeCounts returns the counters accumulated since the CircuitBreaker was created.
+// Unlike Counts, they are never cleared and include the results of the requests
+// sent before clearing. They don't affect the state of the CircuitBreaker.
+func (cb *CircuitBreaker[T]) LifetimeCounts() Counts {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.lifetime
+}
+
+// GenerationStats returns the records of the recent generations of the CircuitBreaker
+// in the order they ended, up to the last 32.
+func (cb *CircuitBreaker[T]) GenerationStats() []GenerationRecord {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.generations.snapshot()
+}
+
+// Metrics returns the numbers of requests and events counted since the CircuitBreaker was created.
+// Metrics doesn't block the CircuitBreaker.
+func (cb *CircuitBreaker[T]) Metrics() Metrics {
+	return cb.metrics.snapshot()
+}
+
+// Reset places the CircuitBreaker into the closed state and clears the internal Counts.
+func (cb *CircuitBreaker[T]) Reset() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.logAction("reset")
+	cb.failOpen = false
+	now := cb.clock.Now()
+	prev := cb.state
+	cb.setState(StateClosed, now)
+	if prev.closed() {
+		// setState starts no new generation between the closed and the degraded states
+		cb.toNewGeneration(now)
+	}
+}
+
+// Trip places the CircuitBreaker into the open state by hand, as if a failure made ReadyToTrip return true.
+// The CircuitBreaker then recovers after Timeout as usual, unless ManualResetOnly is set.
+// Trip does nothing if the CircuitBreaker is already open.
+func (cb *CircuitBreaker[T]) Trip() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.logAction("trip")
+	now := cb.clock.Now()
+	if state, _ := cb.currentState(now); state != StateOpen {
+		cb.trip(now, nil)
+	}
+}
+
+// FailOpen reports whether the CircuitBreaker fails open after an error that FailOpenOn matched.
+func (cb *CircuitBreaker[T]) FailOpen() bool {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.failOpen
+}
+
+// UpdateSettings applies MaxRequests, Interval, Timeout and MaxTimeout of st to the CircuitBreaker
+// while keeping its state, generation and Counts.
+// The new Interval and Timeout take effect from the next generation.
+// The other fields of st are ignored, except Name, which cannot be changed.
+// UpdateSettings returns an error without applying anything if Name differs or st is invalid.
+func (cb *CircuitBreaker[T]) UpdateSettings(st Settings) error {
+	if st.Name != cb.name {
+		return fmt.Errorf("cannot change Name from %q to %q", cb.name, st.Name)
+	}
+	if err := st.Validate(); err != nil {
+		return err
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.applyLimits(st)
+	cb.logAction("update_settings",
+		slog.Uint64("max_requests", uint64(cb.maxRequests)),
+		slog.Duration("interval", cb.interval),
+		slog.Duration("timeout", cb.timeout),
+		slog.Duration("max_timeout", cb.maxTimeout),
+	)
+	return nil
+}
+
+// WouldAllow reports whether the CircuitBreaker would accept a request of priority 0 now,
+// together with the current state.
+// Unlike Execute, WouldAllow counts nothing and doesn't use up MaxRequests in the half-open state.
+func (cb *CircuitBreaker[T]) WouldAllow() (bool, State) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	now := cb.clock.Now()
+	state, _ := cb.currentState(now)
+	if state == StateHalfOpen && cb.abandoned(now) {
+		// decide as if the abandoned slots were reclaimed, as beforeRequest does
+		requests := cb.counts.Requests
+		cb.counts.Requests = 0
+		defer func() { cb.counts.Requests = requests }()
+	}
+
+	_, err := cb.admit(state, now, 0)
+	return err == nil, state
+}
+
+// LastTripError returns the error of the failed request that most recently
+// placed the CircuitBreaker into the open state.
+// It returns nil if the CircuitBreaker has never tripped or the failure was
+// reported without an error, e.g. by TwoStepCircuitBreaker or Trip.
+func (cb *CircuitBreaker[T]) LastTripError() error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.lastTripErr
+}
+
 // Execute runs the given request if the CircuitBreaker accepts it.
-// Execute returns an error instantly if the CircuitBreaker rejects the request.
-// Otherwise, Execute returns the result of the request.
+// Execute returns the zero value of T and an error instantly if the CircuitBreaker rejects the request
+// or the request is nil. Otherwise, Execute returns the result of the request.
 // If a panic occurs in the request, the CircuitBreaker handles it as an error
 // and causes the same panic again.
 func (cb *CircuitBreaker[T]) Execute(req func() (T, error)) (T, error) {
-	generation, err := cb.beforeRequest()
+	return cb.execute(0, req)
+}
+
+// ExecuteClassified is like Execute but lets the given request decide the outcome by itself.
+// The returned Outcome overrides IsSuccessful and MinSuccessLatency.
+func (cb *CircuitBreaker[T]) ExecuteClassified(req func() (T, error, Outcome)) (T, error) {
+	if req == nil {
+		var defaultValue T
+		return defaultValue, ErrNilRequest
+	}
+
+	var o Outcome
+	return cb.run(0, "", func() (T, error) {
+		var result T
+		var err error
+		result, err, o = req()
+		return result, err
+	}, func(T, error, time.Duration) Outcome { return o })
+}
+
+// ExecuteContext is like Execute but passes ctx to the given request,
+// so that the request can observe the cancellation and the deadline of ctx.
+// ExecuteContext rejects the request with ErrDeadlineTooShort
+// if the deadline of ctx is closer than MinRemainingDeadline.
+func (cb *CircuitBreaker[T]) ExecuteContext(ctx context.Context, req func(ctx context.Context) (T, error)) (T, error) {
+	if req == nil {
+		var defaultValue T
+		return defaultValue, ErrNilRequest
+	}
+
+	id := cb.correlationID(ctx)
+	if deadline, ok := ctx.Deadline(); ok && cb.minRemainingDeadline > 0 && time.Until(deadline) < cb.minRemainingDeadline {
+		var defaultValue T
+		return defaultValue, cb.reject(id, RejectDeadlineTooShort, ErrDeadlineTooShort)
+	}
+
+	return cb.run(0, id, func() (T, error) { return req(ctx) }, cb.classify)
+}
+
+// correlationID returns the correlation ID held by ctx, if any.
+func (cb *CircuitBreaker[T]) correlationID(ctx context.Context) string {
+	if cb.correlationIDKey == nil {
+		return ""
+	}
+
+	switch v := ctx.Value(cb.correlationIDKey).(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// ExecutePriority is like Execute but sends the request with the given priority.
+// When the CircuitBreaker is half-open or degraded,
+// the request is rejected with ErrLowPriority if the priority is under SheddingMinPriority.
+func (cb *CircuitBreaker[T]) ExecutePriority(priority int, req func() (T, error)) (T, error) {
+	return cb.execute(priority, req)
+}
+
+func (cb *CircuitBreaker[T]) execute(priority int, req func() (T, error)) (T, error) {
+	if req == nil {
+		var defaultValue T
+		return defaultValue, ErrNilRequest
+	}
+
+	return cb.run(priority, "", req, cb.classify)
+}
+
+func (cb *CircuitBreaker[T]) run(priority int, id string, req func() (T, error), classify func(T, error, time.Duration) Outcome) (result T, err error) {
+	if cb.bulkhead != nil {
+		if !cb.bulkhead.acquire() {
+			var defaultValue T
+			return defaultValue, cb.reject(id, RejectBulkheadFull, ErrBulkheadFull)
+		}
+		defer cb.bulkhead.release()
+	}
+
+	generation, start, err := cb.beforeRequest(priority, id)
 	if err != nil {
 		var defaultValue T
 		return defaultValue, err
@@ -234,17 +1027,92 @@ func (cb *CircuitBreaker[T]) Execute(req func() (T, error)) (T, error) {
 
 	defer func() {
 		e := recover()
-		if e != nil {
-			cb.afterRequest(generation, false)
+		if e == nil {
+			return
+		}
+
+		pe := &PanicError{Value: e}
+		cb.afterRequest(generation, id, OutcomeFailure, pe, cb.clock.Now(), 0)
+		if !cb.recoverPanics {
 			panic(e)
 		}
+		var defaultValue T
+		result, err = defaultValue, pe
 	}()
 
-	result, err := req()
-	cb.afterRequest(generation, cb.isSuccessful(err))
+	result, err = req()
+	end := cb.clock.Now()
+	latency := end.Sub(start)
+	if cb.normalizeError != nil {
+		err = cb.normalizeError(err)
+	}
+	o := classify(result, err, latency)
+	if o == OutcomeSuccess && cb.lastSuccessTTL > 0 {
+		cb.storeLastSuccess(result, end)
+	}
+	cb.afterRequest(generation, id, o, err, end, latency)
+	if err != nil && cb.retryableClassifier != nil {
+		err = &retryableError{err: err, retryable: cb.retryableClassifier(err)}
+	}
 	return result, err
 }
 
+// ExecuteWithStale is like Execute but, while the CircuitBreaker is open,
+// returns the result of the last successful request with stale set to true instead of ErrOpenState,
+// if the result was kept within LastSuccessTTL.
+func (cb *CircuitBreaker[T]) ExecuteWithStale(req func() (T, error)) (result T, stale bool, err error) {
+	result, err = cb.Execute(req)
+	if err != ErrOpenState {
+		return result, false, err
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.lastSuccessAt.IsZero() || cb.clock.Now().Sub(cb.lastSuccessAt) > cb.lastSuccessTTL {
+		return result, false, err
+	}
+	return cb.lastSuccess, true, nil
+}
+
+// ExecuteWithPreCheck is like ExecuteContext but consults preCheck first.
+// If preCheck returns true for skip, ExecuteWithPreCheck returns the result of preCheck immediately
+// without running the request, and the request is neither admitted nor counted by the CircuitBreaker.
+// If preCheck is nil, ExecuteWithPreCheck is the same as ExecuteContext.
+func (cb *CircuitBreaker[T]) ExecuteWithPreCheck(ctx context.Context, preCheck func(ctx context.Context) (skip bool, result T), req func(ctx context.Context) (T, error)) (T, error) {
+	if preCheck != nil {
+		if skip, result := preCheck(ctx); skip {
+			return result, nil
+		}
+	}
+
+	return cb.ExecuteContext(ctx, req)
+}
+
+func (cb *CircuitBreaker[T]) storeLastSuccess(result T, now time.Time) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.lastSuccess = result
+	cb.lastSuccessAt = now
+}
+
+func (cb *CircuitBreaker[T]) classify(result T, err error, latency time.Duration) Outcome {
+	return cb.classifier.Classify(result, err, latency)
+}
+
+// ClassifyError returns the Outcome that Execute would count for a request returning err,
+// without executing any request.
+// err is passed through NormalizeError and SuccessClassifier
+// as if the request returned the zero value of T with no latency.
+func (cb *CircuitBreaker[T]) ClassifyError(err error) Outcome {
+	if cb.normalizeError != nil {
+		err = cb.normalizeError(err)
+	}
+	var result T
+	return cb.classify(result, err, 0)
+}
+
 // Name returns the name of the TwoStepCircuitBreaker.
 func (tscb *TwoStepCircuitBreaker[T]) Name() string {
 	return tscb.cb.Name()
@@ -260,121 +1128,414 @@ func (tscb *TwoStepCircuitBreaker[T]) Counts() Counts {
 	return tscb.cb.Counts()
 }
 
+// GenerationStats returns the records of the recent generations of the TwoStepCircuitBreaker.
+func (tscb *TwoStepCircuitBreaker[T]) GenerationStats() []GenerationRecord {
+	return tscb.cb.GenerationStats()
+}
+
+// Metrics returns the numbers of requests and events counted since the TwoStepCircuitBreaker was created.
+func (tscb *TwoStepCircuitBreaker[T]) Metrics() Metrics {
+	return tscb.cb.Metrics()
+}
+
+// Reset places the TwoStepCircuitBreaker into the closed state and clears the internal Counts.
+func (tscb *TwoStepCircuitBreaker[T]) Reset() {
+	tscb.cb.Reset()
+}
+
+// Trip places the TwoStepCircuitBreaker into the open state by hand.
+func (tscb *TwoStepCircuitBreaker[T]) Trip() {
+	tscb.cb.Trip()
+}
+
+// WouldAllow reports whether the TwoStepCircuitBreaker would accept a request now,
+// together with the current state.
+func (tscb *TwoStepCircuitBreaker[T]) WouldAllow() (bool, State) {
+	return tscb.cb.WouldAllow()
+}
+
+// LifetimeCounts returns the counters accumulated since the TwoStepCircuitBreaker was created.
+func (tscb *TwoStepCircuitBreaker[T]) LifetimeCounts() Counts {
+	return tscb.cb.LifetimeCounts()
+}
+
+// FailOpen reports whether the TwoStepCircuitBreaker fails open.
+func (tscb *TwoStepCircuitBreaker[T]) FailOpen() bool {
+	return tscb.cb.FailOpen()
+}
+
+// UpdateSettings applies the limits of st to the TwoStepCircuitBreaker as CircuitBreaker.UpdateSettings does.
+func (tscb *TwoStepCircuitBreaker[T]) UpdateSettings(st Settings) error {
+	return tscb.cb.UpdateSettings(st)
+}
+
 // Allow checks if a new request can proceed. It returns a callback that should be used to
 // register the success or failure in a separate step. If the circuit breaker doesn't allow
 // requests, it returns an error.
 func (tscb *TwoStepCircuitBreaker[T]) Allow() (done func(success bool), err error) {
-	generation, err := tscb.cb.beforeRequest()
+	generation, _, err := tscb.cb.beforeRequest(0, "")
 	if err != nil {
 		return nil, err
 	}
 
 	return func(success bool) {
-		tscb.cb.afterRequest(generation, success)
+		if success {
+			tscb.cb.afterRequest(generation, "", OutcomeSuccess, nil, tscb.cb.clock.Now(), 0)
+		} else {
+			tscb.cb.afterRequest(generation, "", OutcomeFailure, nil, tscb.cb.clock.Now(), 0)
+		}
 	}, nil
 }
 
-func (cb *CircuitBreaker[T]) beforeRequest() (uint64, error) {
+// beforeRequest admits a request of the given priority with the correlation ID id
+// and returns the generation and the time of the admission.
+func (cb *CircuitBreaker[T]) beforeRequest(priority int, id string) (uint64, time.Time, error) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	if id != "" {
+		cb.cause = id
+		defer func() { cb.cause = "" }()
+	}
+
+	now := cb.clock.Now()
 	state, generation := cb.currentState(now)
+	if state == StateHalfOpen && cb.abandoned(now) {
+		cb.toNewGeneration(now)
+		generation = cb.generation
+	}
 
-	if state == StateOpen {
-		return generation, ErrOpenState
-	} else if state == StateHalfOpen && cb.counts.Requests >= cb.maxRequests {
-		return generation, ErrTooManyRequests
+	if reason, err := cb.admit(state, now, priority); err != nil {
+		return generation, now, cb.rejectAt(now, id, reason, err)
 	}
 
+	if state.closed() && cb.limiter != nil && !cb.failOpen {
+		cb.limiter.take()
+	}
 	cb.counts.onRequest()
-	return generation, nil
+	cb.lifetime.onRequest()
+	cb.metrics.requests.Add(1)
+	cb.lastAdmitted = now
+	if cb.timeline != nil {
+		cb.timeline.record(Event{Time: now, Type: EventAdmitted})
+	}
+
+	if cb.onAllow != nil {
+		cb.onAllow(cb.name, state, generation)
+	}
+	return generation, now, nil
+}
+
+// admit decides whether a request of the given priority can proceed in state at now
+// without counting the request.
+func (cb *CircuitBreaker[T]) admit(state State, now time.Time, priority int) (RejectReason, error) {
+	if cb.maintenance != nil {
+		return RejectMaintenance, cb.maintenance
+	} else if cb.failOpen {
+		return 0, nil
+	} else if state == StateOpen {
+		return RejectOpen, ErrOpenState
+	} else if state == StateHalfOpen && (cb.probeFunc != nil || cb.counts.Requests >= cb.maxRequests) {
+		return RejectTooManyRequests, ErrTooManyRequests
+	} else if (state == StateHalfOpen || state == StateDegraded) && priority < cb.sheddingMinPriority {
+		return RejectLowPriority, ErrLowPriority
+	} else if state.closed() && cb.limiter != nil && !cb.limiter.ready(now) {
+		return RejectRateLimited, ErrRateLimited
+	}
+	return 0, nil
+}
+
+func (cb *CircuitBreaker[T]) abandoned(now time.Time) bool {
+	return cb.halfOpenSlotTimeout > 0 &&
+		cb.counts.Requests >= cb.maxRequests &&
+		cb.counts.TotalSuccesses+cb.counts.TotalFailures < cb.counts.Requests &&
+		!now.Before(cb.lastAdmitted.Add(cb.halfOpenSlotTimeout))
+}
+
+// reject rejects a request with the correlation ID id for reason outside beforeRequest.
+// It holds the mutex so that the callbacks never run concurrently, as in beforeRequest.
+func (cb *CircuitBreaker[T]) reject(id string, reason RejectReason, err error) error {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	return cb.rejectAt(time.Time{}, id, reason, err)
+}
+
+// rejectAt rejects a request with the correlation ID id for reason at now,
+// which is read from the clock only if needed when it is zero.
+func (cb *CircuitBreaker[T]) rejectAt(now time.Time, id string, reason RejectReason, err error) error {
+	cb.metrics.rejections.Add(1)
+	if cb.timeline != nil {
+		if now.IsZero() {
+			now = cb.clock.Now()
+		}
+		cb.timeline.record(Event{Time: now, Type: EventRejected, Reason: reason})
+	}
+	if cb.onReject != nil {
+		cb.onReject(cb.name, reason)
+	}
+	if cb.onRejectWithID != nil {
+		cb.onRejectWithID(cb.name, reason, id)
+	}
+	if reason.LoadShed() {
+		cb.metrics.loadSheds.Add(1)
+		if cb.onLoadShed != nil {
+			cb.onLoadShed(cb.name, reason)
+		}
+	}
+	return err
 }
 
-func (cb *CircuitBreaker[T]) afterRequest(before uint64, success bool) {
+// afterRequest counts the outcome o of a request admitted in the generation before with the correlation ID id,
+// which completed at now taking latency, or 0 if unknown.
+func (cb *CircuitBreaker[T]) afterRequest(before uint64, id string, o Outcome, err error, now time.Time, latency time.Duration) {
+	timeout := o == OutcomeFailure && err != nil && cb.isTimeout(err)
+	failOpen := err != nil && cb.failOpenOn != nil && cb.failOpenOn(err)
+
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
-	now := time.Now()
+	if id != "" {
+		cb.cause = id
+		defer func() { cb.cause = "" }()
+	}
+
+	switch o {
+	case OutcomeSuccess:
+		cb.lifetime.onSuccess()
+		cb.metrics.successes.Add(1)
+	case OutcomeFailure:
+		cb.lifetime.onFailure(timeout)
+		cb.metrics.failures.Add(1)
+	}
+
 	state, generation := cb.currentState(now)
-	if generation != before {
+	if cb.timeline != nil {
+		cb.timeline.record(Event{Time: now, Type: outcomeEvents[o]})
+	}
+	if failOpen && !cb.failOpen {
+		cb.failOpen = true
+		cb.logAction("fail_open", slog.String("error", err.Error()))
+	}
+	if cb.failOpen || generation != before {
 		return
 	}
 
-	if success {
-		cb.onSuccess(state, now)
-	} else {
-		cb.onFailure(state, now)
+	switch o {
+	case OutcomeSuccess:
+		cb.onSuccess(state, now, latency)
+	case OutcomeFailure:
+		cb.onFailure(state, now, err, timeout)
+	case OutcomeIgnore:
+		if state == StateHalfOpen {
+			cb.counts.Requests--
+		}
 	}
 }
 
-func (cb *CircuitBreaker[T]) onSuccess(state State, now time.Time) {
+func (cb *CircuitBreaker[T]) onSuccess(state State, now time.Time, latency time.Duration) {
 	switch state {
 	case StateClosed:
 		cb.counts.onSuccess()
+	case StateDegraded:
+		cb.counts.onSuccess()
+		if !cb.readyToDegrade(cb.counts) {
+			cb.setState(StateClosed, now)
+		}
 	case StateHalfOpen:
+		if cb.healthyLatency > 0 && latency > cb.healthyLatency {
+			cb.toNewGeneration(now)
+			return
+		}
 		cb.counts.onSuccess()
-		if cb.counts.ConsecutiveSuccesses >= cb.maxRequests {
+		if cb.readyToClose(now) {
 			cb.setState(StateClosed, now)
 		}
 	}
 }
 
-func (cb *CircuitBreaker[T]) onFailure(state State, now time.Time) {
+func (cb *CircuitBreaker[T]) onFailure(state State, now time.Time, err error, timeout bool) {
 	switch state {
-	case StateClosed:
-		cb.counts.onFailure()
+	case StateClosed, StateDegraded:
+		cb.counts.onFailure(timeout)
+		if now.Before(cb.warmupEnd) {
+			return
+		}
 		if cb.readyToTrip(cb.counts) {
-			cb.setState(StateOpen, now)
+			cb.trip(now, err)
+			return
+		}
+		cb.warnTrip()
+		if state == StateClosed && cb.readyToDegrade != nil && cb.readyToDegrade(cb.counts) {
+			cb.setState(StateDegraded, now)
 		}
 	case StateHalfOpen:
-		cb.setState(StateOpen, now)
+		if cb.maxTimeout > cb.timeout {
+			cb.backoff++
+		}
+		cb.trip(now, err)
 	}
 }
 
+func (cb *CircuitBreaker[T]) warnTrip() {
+	if cb.onApproachingTrip == nil || cb.tripProgress == nil || cb.tripWarned {
+		return
+	}
+
+	fraction := cb.tripProgress(cb.counts)
+	if fraction >= cb.tripWarningFraction {
+		cb.tripWarned = true
+		cb.onApproachingTrip(cb.name, cb.counts, fraction)
+	}
+}
+
+func (cb *CircuitBreaker[T]) trip(now time.Time, err error) {
+	cb.lastTripErr = err
+	cb.setState(StateOpen, now)
+}
+
 func (cb *CircuitBreaker[T]) currentState(now time.Time) (State, uint64) {
 	switch cb.state {
-	case StateClosed:
+	case StateClosed, StateDegraded:
 		if !cb.expiry.IsZero() && cb.expiry.Before(now) {
 			cb.toNewGeneration(now)
 		}
 	case StateOpen:
-		if cb.expiry.Before(now) {
+		if !cb.manualResetOnly && cb.expiry.Before(now) {
 			cb.setState(StateHalfOpen, now)
+			if cb.probeFunc != nil {
+				go cb.probe(cb.generation)
+			}
+		}
+	case StateHalfOpen:
+		if cb.readyToClose(now) {
+			cb.setState(StateClosed, now)
 		}
 	}
+	if cb.pending {
+		cb.notifyPending(now)
+	}
 	return cb.state, cb.generation
 }
 
+func (cb *CircuitBreaker[T]) readyToClose(now time.Time) bool {
+	return cb.counts.ConsecutiveSuccesses >= cb.maxRequests &&
+		!now.Before(cb.halfOpenSince.Add(cb.minHalfOpenDuration))
+}
+
 func (cb *CircuitBreaker[T]) setState(state State, now time.Time) {
 	if cb.state == state {
 		return
 	}
 
 	prev := cb.state
+	counts := cb.counts
 	cb.state = state
+	if state == StateHalfOpen {
+		cb.halfOpenSince = now
+	} else if state == StateClosed {
+		cb.backoff = 0
+	}
 
-	cb.toNewGeneration(now)
+	if !prev.closed() || !state.closed() {
+		cb.toNewGeneration(now)
+	}
+	if state == StateOpen && cb.probeSchedule > 0 {
+		cb.scheduleProbe(cb.generation)
+	}
+	cb.metrics.stateChanges.Add(1)
+	if cb.timeline != nil {
+		cb.timeline.record(Event{Time: now, Type: EventStateChange, From: prev, To: state})
+	}
+	cb.logStateChange(prev, counts)
 
+	if cb.pending {
+		// the listeners have not been notified of prev yet
+		prev = cb.notifiedState
+		if prev == state {
+			cb.pending = false
+			return
+		}
+	}
+	if cb.debounced(prev, state, now) {
+		cb.notify(prev, state)
+	}
+}
+
+func (cb *CircuitBreaker[T]) notify(prev State, state State) {
 	if cb.onStateChange != nil {
 		cb.onStateChange(cb.name, prev, state)
 	}
+	if cb.onStateChangeWithID != nil {
+		cb.onStateChangeWithID(cb.name, prev, state, cb.cause)
+	}
+}
+
+// notifyPending notifies the transitions coalesced under OnStateChangeMinInterval at now
+// as a single transition from the last notified state to the current state.
+func (cb *CircuitBreaker[T]) notifyPending(now time.Time) {
+	if cb.state == cb.notifiedState {
+		cb.pending = false
+		return
+	}
+
+	prev := cb.notifiedState
+	if cb.debounced(prev, cb.state, now) {
+		cb.notify(prev, cb.state)
+	}
+}
+
+// debounced reports whether the transition from prev to state at now is to be notified
+// under OnStateChangeMinInterval. A transition not to be notified is left pending from prev.
+func (cb *CircuitBreaker[T]) debounced(prev State, state State, now time.Time) bool {
+	if cb.notifyMinInterval <= 0 {
+		return true
+	}
+
+	transition := [2]State{prev, state}
+	if last, ok := cb.notified[transition]; ok && now.Sub(last) < cb.notifyMinInterval {
+		if !cb.pending {
+			cb.pending = true
+			cb.notifiedState = prev
+		}
+		return false
+	}
+	cb.pending = false
+
+	if cb.notified == nil {
+		cb.notified = make(map[[2]State]time.Time)
+	}
+	cb.notified[transition] = now
+	return true
+}
+
+func (cb *CircuitBreaker[T]) openTimeout() time.Duration {
+	timeout := cb.timeout
+	for i := uint(0); i < cb.backoff && timeout < cb.maxTimeout; i++ {
+		timeout *= 2
+	}
+	if timeout > cb.maxTimeout {
+		timeout = cb.maxTimeout
+	}
+	return timeout
 }
 
 func (cb *CircuitBreaker[T]) toNewGeneration(now time.Time) {
 	cb.generation++
 	cb.counts.clear()
+	cb.generations.onNewGeneration(cb.state, now)
+	cb.tripWarned = false
 
 	var zero time.Time
 	switch cb.state {
-	case StateClosed:
+	case StateClosed, StateDegraded:
 		if cb.interval == 0 {
 			cb.expiry = zero
 		} else {
 			cb.expiry = now.Add(cb.interval)
 		}
 	case StateOpen:
-		cb.expiry = now.Add(cb.timeout)
+		cb.expiry = now.Add(cb.openTimeout())
 	default: // StateHalfOpen
 		cb.expiry = zero
 	}
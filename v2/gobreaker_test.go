@@ -1,11 +1,20 @@
 package gobreaker
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math"
+	"os"
 	"runtime"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/sony/gobreaker/v2/gobreakertest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -73,7 +82,7 @@ func fail2Step(cb *TwoStepCircuitBreaker[bool]) error {
 }
 
 func causePanic(cb *CircuitBreaker[bool]) error {
-	_, err := cb.Execute(func() (bool, error) { panic("oops"); return false, nil })
+	_, err := cb.Execute(func() (bool, error) { panic("oops") })
 	return err
 }
 
@@ -116,13 +125,35 @@ func TestStateConstants(t *testing.T) {
 	assert.Equal(t, State(0), StateClosed)
 	assert.Equal(t, State(1), StateHalfOpen)
 	assert.Equal(t, State(2), StateOpen)
+	assert.Equal(t, State(3), StateDegraded)
 
 	assert.Equal(t, StateClosed.String(), "closed")
 	assert.Equal(t, StateHalfOpen.String(), "half-open")
 	assert.Equal(t, StateOpen.String(), "open")
+	assert.Equal(t, StateDegraded.String(), "degraded")
 	assert.Equal(t, State(100).String(), "unknown state: 100")
 }
 
+func TestRejectReasonConstants(t *testing.T) {
+	assert.Equal(t, RejectOpen.String(), "open")
+	assert.Equal(t, RejectTooManyRequests.String(), "too_many_requests")
+	assert.Equal(t, RejectRateLimited.String(), "rate_limited")
+	assert.Equal(t, RejectLowPriority.String(), "low_priority")
+	assert.Equal(t, RejectBulkheadFull.String(), "bulkhead_full")
+	assert.Equal(t, RejectDeadlineTooShort.String(), "deadline_too_short")
+	assert.Equal(t, RejectMaintenance.String(), "maintenance")
+	assert.Equal(t, RejectReason(100).String(), "unknown reason: 100")
+}
+
+func TestIsBreakerError(t *testing.T) {
+	for _, err := range []error{ErrTooManyRequests, ErrOpenState, ErrRateLimited, ErrNilRequest, ErrLowPriority, ErrBulkheadFull, ErrDeadlineTooShort, ErrMaintenance} {
+		assert.True(t, IsBreakerError(err))
+		assert.True(t, IsBreakerError(fmt.Errorf("wrapped: %w", err)))
+	}
+	assert.False(t, IsBreakerError(nil))
+	assert.False(t, IsBreakerError(errors.New("circuit breaker is open")))
+}
+
 func TestNewCircuitBreaker(t *testing.T) {
 	defaultCB := NewCircuitBreaker[bool](Settings{})
 	assert.Equal(t, "", defaultCB.name)
@@ -132,7 +163,7 @@ func TestNewCircuitBreaker(t *testing.T) {
 	assert.NotNil(t, defaultCB.readyToTrip)
 	assert.Nil(t, defaultCB.onStateChange)
 	assert.Equal(t, StateClosed, defaultCB.state)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.True(t, defaultCB.expiry.IsZero())
 
 	customCB := newCustom()
@@ -143,7 +174,7 @@ func TestNewCircuitBreaker(t *testing.T) {
 	assert.NotNil(t, customCB.readyToTrip)
 	assert.NotNil(t, customCB.onStateChange)
 	assert.Equal(t, StateClosed, customCB.state)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, customCB.counts)
 	assert.False(t, customCB.expiry.IsZero())
 
 	negativeDurationCB := newNegativeDurationCB()
@@ -154,10 +185,68 @@ func TestNewCircuitBreaker(t *testing.T) {
 	assert.NotNil(t, negativeDurationCB.readyToTrip)
 	assert.Nil(t, negativeDurationCB.onStateChange)
 	assert.Equal(t, StateClosed, negativeDurationCB.state)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, negativeDurationCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, negativeDurationCB.counts)
 	assert.True(t, negativeDurationCB.expiry.IsZero())
 }
 
+func TestCountsRatios(t *testing.T) {
+	var counts Counts
+	assert.Equal(t, 0.0, counts.FailureRatio())
+	assert.Equal(t, 0.0, counts.SuccessRatio())
+
+	counts = Counts{Requests: 4, TotalSuccesses: 1, TotalFailures: 2}
+	assert.Equal(t, 0.5, counts.FailureRatio())
+	assert.Equal(t, 0.25, counts.SuccessRatio())
+}
+
+func TestValidateSettings(t *testing.T) {
+	assert.Nil(t, Settings{}.Validate())
+	assert.Nil(t, Settings{
+		Name:              "cb",
+		Interval:          time.Duration(30) * time.Second,
+		RateLimit:         10,
+		RateBurst:         5,
+		MinSuccessLatency: time.Millisecond,
+	}.Validate())
+
+	err := Settings{Timeout: -time.Second}.Validate()
+	assert.EqualError(t, err, "negative Timeout: -1s")
+
+	err = Settings{LastSuccessTTL: -time.Second}.Validate()
+	assert.EqualError(t, err, "negative LastSuccessTTL: -1s")
+
+	err = Settings{
+		Interval:             -time.Second,
+		WarmupPeriod:         -time.Minute,
+		RateLimit:            math.NaN(),
+		FastSuccessAsFailure: true,
+	}.Validate()
+	assert.EqualError(t, err, "negative Interval: -1s\n"+
+		"negative WarmupPeriod: -1m0s\n"+
+		"invalid RateLimit: NaN\n"+
+		"FastSuccessAsFailure without MinSuccessLatency")
+
+	err = Settings{RateBurst: 5}.Validate()
+	assert.EqualError(t, err, "RateBurst without RateLimit")
+
+	err = Settings{SuccessClassifier: ErrorClassifier(nil), IsSuccessful: defaultIsSuccessful}.Validate()
+	assert.EqualError(t, err, "SuccessClassifier with IsSuccessful or MinSuccessLatency")
+
+	err = Settings{MaxWait: time.Second}.Validate()
+	assert.EqualError(t, err, "MaxWait without MaxConcurrent")
+}
+
+func TestNewCircuitBreakerFromCaller(t *testing.T) {
+	cb1 := NewCircuitBreakerFromCaller[bool](Settings{})
+	cb2 := NewCircuitBreakerFromCaller[bool](Settings{})
+	assert.Regexp(t, `^github\.com/sony/gobreaker/v2\.TestNewCircuitBreakerFromCaller@gobreaker_test\.go:\d+$`, cb1.Name())
+	assert.Regexp(t, `^github\.com/sony/gobreaker/v2\.TestNewCircuitBreakerFromCaller@gobreaker_test\.go:\d+$`, cb2.Name())
+	assert.NotEqual(t, cb1.Name(), cb2.Name())
+
+	cb := NewCircuitBreakerFromCaller[bool](Settings{Name: "cb"})
+	assert.Equal(t, "cb", cb.Name())
+}
+
 func TestDefaultCircuitBreaker(t *testing.T) {
 	assert.Equal(t, "", defaultCB.Name())
 
@@ -165,27 +254,27 @@ func TestDefaultCircuitBreaker(t *testing.T) {
 		assert.Nil(t, fail(defaultCB))
 	}
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{5, 0, 5, 0, 5}, defaultCB.counts)
+	assert.Equal(t, Counts{5, 0, 5, 0, 5, 0}, defaultCB.counts)
 
 	assert.Nil(t, succeed(defaultCB))
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{6, 1, 5, 1, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{6, 1, 5, 1, 0, 0}, defaultCB.counts)
 
 	assert.Nil(t, fail(defaultCB))
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{7, 1, 6, 0, 1}, defaultCB.counts)
+	assert.Equal(t, Counts{7, 1, 6, 0, 1, 0}, defaultCB.counts)
 
 	// StateClosed to StateOpen
 	for i := 0; i < 5; i++ {
 		assert.Nil(t, fail(defaultCB)) // 6 consecutive failures
 	}
 	assert.Equal(t, StateOpen, defaultCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.False(t, defaultCB.expiry.IsZero())
 
 	assert.Error(t, succeed(defaultCB))
 	assert.Error(t, fail(defaultCB))
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, defaultCB.counts)
 
 	pseudoSleep(defaultCB, time.Duration(59)*time.Second)
 	assert.Equal(t, StateOpen, defaultCB.State())
@@ -198,7 +287,7 @@ func TestDefaultCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateOpen
 	assert.Nil(t, fail(defaultCB))
 	assert.Equal(t, StateOpen, defaultCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.False(t, defaultCB.expiry.IsZero())
 
 	// StateOpen to StateHalfOpen
@@ -209,7 +298,7 @@ func TestDefaultCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateClosed
 	assert.Nil(t, succeed(defaultCB))
 	assert.Equal(t, StateClosed, defaultCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, defaultCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, defaultCB.counts)
 	assert.True(t, defaultCB.expiry.IsZero())
 }
 
@@ -221,23 +310,23 @@ func TestCustomCircuitBreaker(t *testing.T) {
 		assert.Nil(t, fail(customCB))
 	}
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{10, 5, 5, 0, 1}, customCB.counts)
+	assert.Equal(t, Counts{10, 5, 5, 0, 1, 0}, customCB.counts)
 
 	pseudoSleep(customCB, time.Duration(29)*time.Second)
 	assert.Nil(t, succeed(customCB))
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{11, 6, 5, 1, 0}, customCB.counts)
+	assert.Equal(t, Counts{11, 6, 5, 1, 0, 0}, customCB.counts)
 
 	pseudoSleep(customCB, time.Duration(1)*time.Second) // over Interval
 	assert.Nil(t, fail(customCB))
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{1, 0, 1, 0, 1}, customCB.counts)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, customCB.counts)
 
 	// StateClosed to StateOpen
 	assert.Nil(t, succeed(customCB))
 	assert.Nil(t, fail(customCB)) // failure ratio: 2/3 >= 0.6
 	assert.Equal(t, StateOpen, customCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, customCB.counts)
 	assert.False(t, customCB.expiry.IsZero())
 	assert.Equal(t, StateChange{"cb", StateClosed, StateOpen}, stateChange)
 
@@ -250,16 +339,16 @@ func TestCustomCircuitBreaker(t *testing.T) {
 	assert.Nil(t, succeed(customCB))
 	assert.Nil(t, succeed(customCB))
 	assert.Equal(t, StateHalfOpen, customCB.State())
-	assert.Equal(t, Counts{2, 2, 0, 2, 0}, customCB.counts)
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0}, customCB.counts)
 
 	// StateHalfOpen to StateClosed
 	ch := succeedLater(customCB, time.Duration(100)*time.Millisecond) // 3 consecutive successes
 	time.Sleep(time.Duration(50) * time.Millisecond)
-	assert.Equal(t, Counts{3, 2, 0, 2, 0}, customCB.counts)
+	assert.Equal(t, Counts{3, 2, 0, 2, 0, 0}, customCB.counts)
 	assert.Error(t, succeed(customCB)) // over MaxRequests
 	assert.Nil(t, <-ch)
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, customCB.counts)
 	assert.False(t, customCB.expiry.IsZero())
 	assert.Equal(t, StateChange{"cb", StateHalfOpen, StateClosed}, stateChange)
 }
@@ -273,27 +362,27 @@ func TestTwoStepCircuitBreaker(t *testing.T) {
 	}
 
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{5, 0, 5, 0, 5}, tscb.cb.counts)
+	assert.Equal(t, Counts{5, 0, 5, 0, 5, 0}, tscb.cb.counts)
 
 	assert.Nil(t, succeed2Step(tscb))
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{6, 1, 5, 1, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{6, 1, 5, 1, 0, 0}, tscb.cb.counts)
 
 	assert.Nil(t, fail2Step(tscb))
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{7, 1, 6, 0, 1}, tscb.cb.counts)
+	assert.Equal(t, Counts{7, 1, 6, 0, 1, 0}, tscb.cb.counts)
 
 	// StateClosed to StateOpen
 	for i := 0; i < 5; i++ {
 		assert.Nil(t, fail2Step(tscb)) // 6 consecutive failures
 	}
 	assert.Equal(t, StateOpen, tscb.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 	assert.False(t, tscb.cb.expiry.IsZero())
 
 	assert.Error(t, succeed2Step(tscb))
 	assert.Error(t, fail2Step(tscb))
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 
 	pseudoSleep(tscb.cb, time.Duration(59)*time.Second)
 	assert.Equal(t, StateOpen, tscb.State())
@@ -306,7 +395,7 @@ func TestTwoStepCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateOpen
 	assert.Nil(t, fail2Step(tscb))
 	assert.Equal(t, StateOpen, tscb.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 	assert.False(t, tscb.cb.expiry.IsZero())
 
 	// StateOpen to StateHalfOpen
@@ -317,13 +406,69 @@ func TestTwoStepCircuitBreaker(t *testing.T) {
 	// StateHalfOpen to StateClosed
 	assert.Nil(t, succeed2Step(tscb))
 	assert.Equal(t, StateClosed, tscb.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, tscb.cb.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, tscb.cb.counts)
 	assert.True(t, tscb.cb.expiry.IsZero())
 }
 
+func TestLifetimeCounts(t *testing.T) {
+	cb := newCustom()
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, succeed(cb))
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(30)*time.Second) // over Interval
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+	assert.Equal(t, Counts{10, 5, 5, 0, 1, 0}, cb.LifetimeCounts())
+
+	// StateClosed to StateOpen
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+	assert.Equal(t, Counts{13, 5, 8, 0, 4, 0}, cb.LifetimeCounts())
+
+	// rejected requests are not counted
+	assert.Error(t, succeed(cb))
+	assert.Equal(t, Counts{13, 5, 8, 0, 4, 0}, cb.LifetimeCounts())
+
+	// StateOpen to StateHalfOpen to StateClosed
+	pseudoSleep(cb, time.Duration(90)*time.Second)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+	assert.Equal(t, Counts{16, 8, 8, 3, 0, 0}, cb.LifetimeCounts())
+}
+
 func TestPanicInRequest(t *testing.T) {
 	assert.Panics(t, func() { causePanic(defaultCB) })
-	assert.Equal(t, Counts{1, 0, 1, 0, 1}, defaultCB.counts)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, defaultCB.counts)
+}
+
+func TestRecoverPanics(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	assert.PanicsWithValue(t, "oops", func() { causePanic(cb) })
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, cb.Counts())
+
+	cb = NewCircuitBreaker[bool](Settings{RecoverPanics: true})
+	err := causePanic(cb)
+	assert.True(t, errors.Is(err, ErrPanic))
+	assert.EqualError(t, err, "panic: oops")
+	var pe *PanicError
+	assert.True(t, errors.As(err, &pe))
+	assert.Equal(t, "oops", pe.Value)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, cb.Counts())
+
+	errCause := errors.New("cause")
+	result, err := cb.Execute(func() (bool, error) { panic(errCause) })
+	assert.False(t, result)
+	assert.True(t, errors.Is(err, ErrPanic))
+	assert.True(t, errors.Is(err, errCause))
+	assert.Equal(t, Counts{2, 0, 2, 0, 2, 0}, cb.Counts())
 }
 
 func TestGeneration(t *testing.T) {
@@ -331,15 +476,404 @@ func TestGeneration(t *testing.T) {
 	assert.Nil(t, succeed(customCB))
 	ch := succeedLater(customCB, time.Duration(1500)*time.Millisecond)
 	time.Sleep(time.Duration(500) * time.Millisecond)
-	assert.Equal(t, Counts{2, 1, 0, 1, 0}, customCB.counts)
+	assert.Equal(t, Counts{2, 1, 0, 1, 0, 0}, customCB.counts)
 
 	time.Sleep(time.Duration(500) * time.Millisecond) // over Interval
 	assert.Equal(t, StateClosed, customCB.State())
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, customCB.counts)
 
 	// the request from the previous generation has no effect on customCB.counts
 	assert.Nil(t, <-ch)
-	assert.Equal(t, Counts{0, 0, 0, 0, 0}, customCB.counts)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, customCB.counts)
+}
+
+func TestHalfOpenConcurrentProbes(t *testing.T) {
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{MaxRequests: 2})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	assert.Equal(t, StateOpen, tscb.State())
+
+	pseudoSleep(tscb.cb, time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+
+	done1, err := tscb.Allow()
+	assert.Nil(t, err)
+	done2, err := tscb.Allow()
+	assert.Nil(t, err)
+	generation := tscb.cb.generation
+
+	// one probe fails and reopens the breaker
+	done1(false)
+	assert.Equal(t, StateOpen, tscb.State())
+	assert.Equal(t, generation+1, tscb.cb.generation)
+
+	// the other probe of the same half-open state succeeds later and is ignored
+	done2(true)
+	assert.Equal(t, StateOpen, tscb.State())
+	assert.Equal(t, generation+1, tscb.cb.generation)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, tscb.cb.counts)
+}
+
+func TestDegradedState(t *testing.T) {
+	var changes []StateChange
+	cb := NewCircuitBreaker[bool](Settings{
+		Name: "dcb",
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 4
+		},
+		ReadyToDegrade: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+		OnStateChange: func(name string, from State, to State) {
+			changes = append(changes, StateChange{name, from, to})
+		},
+	})
+
+	// StateClosed to StateDegraded
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateDegraded, cb.State())
+	assert.Equal(t, Counts{2, 0, 2, 0, 2, 0}, cb.counts)
+
+	// StateDegraded to StateClosed
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{3, 1, 2, 1, 0, 0}, cb.counts)
+
+	// StateClosed to StateDegraded to StateOpen
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateDegraded, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateDegraded, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+
+	assert.Equal(t, []StateChange{
+		{"dcb", StateClosed, StateDegraded},
+		{"dcb", StateDegraded, StateClosed},
+		{"dcb", StateClosed, StateDegraded},
+		{"dcb", StateDegraded, StateOpen},
+	}, changes)
+}
+
+func TestResetFromDegraded(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 4
+		},
+		ReadyToDegrade: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateDegraded, cb.State())
+	generation := cb.generation
+
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, generation+1, cb.generation)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestTrip(t *testing.T) {
+	cb := NewTwoStepCircuitBreaker[bool](Settings{Timeout: time.Duration(10) * time.Second})
+	assert.Nil(t, succeed2Step(cb))
+
+	cb.Trip()
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Nil(t, cb.cb.LastTripError())
+	_, err := cb.Allow()
+	assert.Equal(t, ErrOpenState, err)
+
+	// tripping again doesn't extend the timeout
+	expiry := cb.cb.expiry
+	cb.Trip()
+	assert.Equal(t, expiry, cb.cb.expiry)
+
+	pseudoSleep(cb.cb, time.Duration(11)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	cb.Trip()
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestMinHalfOpenDuration(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MaxRequests: 2, MinHalfOpenDuration: time.Duration(10) * time.Second})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0}, cb.counts)
+
+	cb.halfOpenSince = cb.halfOpenSince.Add(-time.Duration(9) * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	// StateHalfOpen to StateClosed
+	cb.halfOpenSince = cb.halfOpenSince.Add(-time.Duration(1) * time.Second) // over MinHalfOpenDuration
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+
+	// enough time without enough successes keeps the breaker half-open
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	cb.halfOpenSince = cb.halfOpenSince.Add(-time.Duration(10) * time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestHalfOpenSlotTimeout(t *testing.T) {
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{HalfOpenSlotTimeout: time.Duration(5) * time.Second})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(tscb))
+	}
+	pseudoSleep(tscb.cb, time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+
+	// the probe is admitted but abandoned
+	abandoned, err := tscb.Allow()
+	assert.Nil(t, err)
+	assert.Equal(t, ErrTooManyRequests, succeed2Step(tscb))
+
+	tscb.cb.lastAdmitted = tscb.cb.lastAdmitted.Add(-time.Duration(4) * time.Second)
+	assert.Equal(t, ErrTooManyRequests, succeed2Step(tscb))
+
+	// the slot is reclaimed
+	tscb.cb.lastAdmitted = tscb.cb.lastAdmitted.Add(-time.Duration(1) * time.Second) // over HalfOpenSlotTimeout
+	done, err := tscb.Allow()
+	assert.Nil(t, err)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+
+	// the late outcome of the abandoned probe is ignored
+	abandoned(false)
+	assert.Equal(t, StateHalfOpen, tscb.State())
+
+	done(true)
+	assert.Equal(t, StateClosed, tscb.State())
+}
+
+func TestWouldAllowAbandoned(t *testing.T) {
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{
+		HalfOpenSlotTimeout: time.Duration(5) * time.Second,
+		SheddingMinPriority: 1,
+	})
+	tscb.cb.setState(StateHalfOpen, time.Now())
+	_, _, err := tscb.cb.beforeRequest(1, "")
+	assert.Nil(t, err)
+	tscb.cb.lastAdmitted = tscb.cb.lastAdmitted.Add(-time.Duration(5) * time.Second) // over HalfOpenSlotTimeout
+
+	// the abandoned slot doesn't bypass the priority check
+	allowed, state := tscb.WouldAllow()
+	assert.False(t, allowed)
+	assert.Equal(t, StateHalfOpen, state)
+	assert.Equal(t, uint32(1), tscb.cb.counts.Requests)
+
+	tscb.cb.sheddingMinPriority = 0
+	allowed, _ = tscb.WouldAllow()
+	assert.True(t, allowed)
+
+	// nor the maintenance mode
+	tscb.EnterMaintenance("m")
+	allowed, _ = tscb.WouldAllow()
+	assert.False(t, allowed)
+	_, err = tscb.Allow()
+	assert.EqualError(t, err, "maintenance: m")
+}
+
+func TestReset(t *testing.T) {
+	cb := newCustom()
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	generation := cb.generation
+
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+	assert.Equal(t, generation+1, cb.generation)
+
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// StateOpen to StateClosed
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, StateChange{"cb", StateOpen, StateClosed}, stateChange)
+}
+
+func TestManualResetOnly(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{ManualResetOnly: true})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	pseudoSleep(cb, time.Duration(600)*time.Second) // far over Timeout
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	cb.Reset()
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, succeed(cb))
+}
+
+func TestExecutePriority(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxRequests:         2,
+		SheddingMinPriority: 10,
+		ReadyToDegrade: func(counts Counts) bool {
+			return counts.ConsecutiveFailures >= 2
+		},
+	})
+	low := func() error {
+		_, err := cb.ExecutePriority(5, func() (bool, error) { return true, nil })
+		return err
+	}
+	high := func() error {
+		_, err := cb.ExecutePriority(10, func() (bool, error) { return true, nil })
+		return err
+	}
+	highFail := func() error {
+		_, err := cb.ExecutePriority(10, func() (bool, error) { return false, errors.New("fail") })
+		return err
+	}
+
+	// StateClosed admits all requests
+	assert.Nil(t, low())
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+
+	// StateDegraded sheds low-priority requests
+	assert.Equal(t, StateDegraded, cb.State())
+	assert.Equal(t, ErrLowPriority, low())
+	assert.Equal(t, ErrLowPriority, succeed(cb))
+	for i := 0; i < 4; i++ {
+		assert.EqualError(t, highFail(), "fail")
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	// StateHalfOpen admits only high-priority requests within MaxRequests
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, ErrLowPriority, low())
+	assert.Nil(t, high())
+	assert.Equal(t, ErrLowPriority, low())
+	assert.Nil(t, high())
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, low())
+}
+
+func TestExecutePriorityOnlyLow(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{SheddingMinPriority: 10})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+
+	// the low-priority requests never probe, so the CircuitBreaker stays half-open however long
+	for i := 0; i < 5; i++ {
+		pseudoSleep(cb, time.Duration(60)*time.Second)
+		_, err := cb.ExecutePriority(5, func() (bool, error) { return true, nil })
+		assert.Equal(t, ErrLowPriority, err)
+		assert.Equal(t, StateHalfOpen, cb.State())
+	}
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	_, err := cb.ExecutePriority(10, func() (bool, error) { return true, nil })
+	assert.Nil(t, err)
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestMaxTimeout(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		Timeout:    time.Duration(10) * time.Second,
+		MaxTimeout: time.Duration(50) * time.Second,
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	// repeated failures in StateHalfOpen double the period of StateOpen up to MaxTimeout
+	for _, timeout := range []int{10, 20, 40, 50, 50} {
+		pseudoSleep(cb, time.Duration(timeout-1)*time.Second)
+		assert.Equal(t, StateOpen, cb.State())
+		pseudoSleep(cb, time.Duration(1)*time.Second)
+		assert.Equal(t, StateHalfOpen, cb.State())
+		assert.Nil(t, fail(cb))
+		assert.Equal(t, StateOpen, cb.State())
+	}
+
+	// StateClosed resets the period of StateOpen
+	pseudoSleep(cb, time.Duration(50)*time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(10)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+}
+
+func TestWouldAllow(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MaxRequests: 2, RateLimit: 1})
+
+	for i := 0; i < 3; i++ {
+		allowed, state := cb.WouldAllow()
+		assert.True(t, allowed)
+		assert.Equal(t, StateClosed, state)
+	}
+	assert.Nil(t, fail(cb))
+
+	// RateLimit is used up
+	allowed, state := cb.WouldAllow()
+	assert.False(t, allowed)
+	assert.Equal(t, StateClosed, state)
+
+	for i := 0; i < 5; i++ {
+		cb.limiter.last = cb.limiter.last.Add(-time.Duration(1) * time.Second)
+		assert.Nil(t, fail(cb))
+	}
+	allowed, state = cb.WouldAllow()
+	assert.False(t, allowed)
+	assert.Equal(t, StateOpen, state)
+
+	// StateHalfOpen
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	for i := 0; i < 3; i++ {
+		allowed, state = cb.WouldAllow()
+		assert.True(t, allowed)
+		assert.Equal(t, StateHalfOpen, state)
+	}
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+
+	ch1 := succeedLater(cb, time.Duration(100)*time.Millisecond)
+	ch2 := succeedLater(cb, time.Duration(100)*time.Millisecond)
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	allowed, state = cb.WouldAllow()
+	assert.False(t, allowed)
+	assert.Equal(t, StateHalfOpen, state)
+	assert.Nil(t, <-ch1)
+	assert.Nil(t, <-ch2)
+	assert.Equal(t, StateClosed, cb.State())
 }
 
 func TestCustomIsSuccessful(t *testing.T) {
@@ -352,18 +886,752 @@ func TestCustomIsSuccessful(t *testing.T) {
 		assert.Nil(t, fail(cb))
 	}
 	assert.Equal(t, StateClosed, cb.State())
-	assert.Equal(t, Counts{5, 5, 0, 5, 0}, cb.counts)
+	assert.Equal(t, Counts{5, 5, 0, 5, 0, 0}, cb.counts)
 
 	cb.counts.clear()
 
-	cb.isSuccessful = func(err error) bool {
+	cb.classifier = ErrorClassifier(func(err error) bool {
 		return err == nil
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
 	}
+	assert.Equal(t, StateOpen, cb.State())
+
+}
+
+func TestNilRequest(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	result, err := cb.Execute(nil)
+	assert.Equal(t, ErrNilRequest, err)
+	assert.Equal(t, 0, result)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+}
+
+func TestZeroValueOnRejection(t *testing.T) {
+	cb := NewCircuitBreaker[*int](Settings{})
 	for i := 0; i < 6; i++ {
+		_, err := cb.Execute(func() (*int, error) { return nil, errors.New("fail") })
+		assert.NotNil(t, err)
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	v := 1
+	result, err := cb.Execute(func() (*int, error) { return &v, nil })
+	assert.Equal(t, ErrOpenState, err)
+	assert.Nil(t, result)
+}
+
+type ctxKey struct{}
+
+func TestExecuteContext(t *testing.T) {
+	cb := NewCircuitBreaker[string](Settings{})
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, "value")
+	result, err := cb.ExecuteContext(ctx, func(ctx context.Context) (string, error) {
+		return ctx.Value(ctxKey{}).(string), nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "value", result)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cb.ExecuteContext(ctx, func(ctx context.Context) (string, error) {
+		<-ctx.Done()
+		return "", ctx.Err()
+	})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0}, cb.counts)
+
+	_, err = cb.ExecuteContext(ctx, nil)
+	assert.Equal(t, ErrNilRequest, err)
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0}, cb.counts)
+}
+
+func TestLastTripError(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	assert.Nil(t, cb.LastTripError())
+
+	for i := 0; i < 5; i++ {
 		assert.Nil(t, fail(cb))
 	}
+	assert.Nil(t, cb.LastTripError())
+
+	tripErr := errors.New("final failure")
+	_, err := cb.Execute(func() (bool, error) { return false, tripErr })
+	assert.Equal(t, tripErr, err)
 	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, tripErr, cb.LastTripError())
 
+	// StateHalfOpen to StateOpen
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Panics(t, func() { causePanic(cb) })
+	assert.Equal(t, StateOpen, cb.State())
+	assert.EqualError(t, cb.LastTripError(), "panic: oops")
+}
+
+func TestNormalizeError(t *testing.T) {
+	errIgnorable := errors.New("ignorable")
+	cb := NewCircuitBreaker[bool](Settings{
+		NormalizeError: func(err error) error {
+			if errors.Is(err, errIgnorable) {
+				return nil
+			}
+			return err
+		},
+	})
+
+	for i := 0; i < 10; i++ {
+		_, err := cb.Execute(func() (bool, error) {
+			return false, fmt.Errorf("wrapped: %w", errIgnorable)
+		})
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{10, 10, 0, 10, 0, 0}, cb.counts)
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestWarmupPeriod(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{WarmupPeriod: time.Duration(10) * time.Second})
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{10, 0, 10, 0, 10, 0}, cb.counts)
+
+	cb.warmupEnd = cb.warmupEnd.Add(-time.Duration(10) * time.Second) // over WarmupPeriod
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestOnReject(t *testing.T) {
+	var reasons []RejectReason
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:      "reject",
+		RateLimit: 1,
+		OnReject: func(name string, reason RejectReason) {
+			assert.Equal(t, "reject", name)
+			reasons = append(reasons, reason)
+		},
+	})
+
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, ErrRateLimited, succeed(cb))
+	assert.Equal(t, []RejectReason{RejectRateLimited}, reasons)
+
+	for i := 0; i < 5; i++ {
+		cb.limiter.last = cb.limiter.last.Add(-time.Duration(1) * time.Second)
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, ErrOpenState, succeed(cb))
+	assert.Equal(t, []RejectReason{RejectRateLimited, RejectOpen}, reasons)
+
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	ch := succeedLater(cb, time.Duration(100)*time.Millisecond)
+	time.Sleep(time.Duration(50) * time.Millisecond)
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	assert.Nil(t, <-ch)
+	assert.Equal(t, []RejectReason{RejectRateLimited, RejectOpen, RejectTooManyRequests}, reasons)
+}
+
+func TestMinSuccessLatency(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MinSuccessLatency: time.Duration(50) * time.Millisecond})
+
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{1, 0, 0, 0, 0, 0}, cb.counts)
+
+	assert.Nil(t, <-succeedLater(cb, time.Duration(60)*time.Millisecond))
+	assert.Equal(t, Counts{2, 1, 0, 1, 0, 0}, cb.counts)
+
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{3, 1, 1, 0, 1, 0}, cb.counts)
+
+	cb = NewCircuitBreaker[bool](Settings{
+		MinSuccessLatency:    time.Duration(50) * time.Millisecond,
+		FastSuccessAsFailure: true,
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestMinSuccessLatencyInHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MinSuccessLatency: time.Duration(50) * time.Millisecond})
+	cb.setState(StateHalfOpen, time.Now())
+
+	// the fast successes are ignored and give back the slot
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+		assert.Equal(t, StateHalfOpen, cb.State())
+		assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.counts)
+	}
+
+	assert.Nil(t, <-succeedLater(cb, time.Duration(60)*time.Millisecond))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+func TestExecuteWithStale(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{LastSuccessTTL: time.Duration(10) * time.Second})
+
+	result, stale, err := cb.ExecuteWithStale(func() (int, error) { return 1, nil })
+	assert.Equal(t, 1, result)
+	assert.False(t, stale)
+	assert.Nil(t, err)
+
+	for i := 0; i < 6; i++ {
+		_, stale, err = cb.ExecuteWithStale(func() (int, error) { return 2, errors.New("fail") })
+		assert.False(t, stale)
+		assert.EqualError(t, err, "fail")
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	result, stale, err = cb.ExecuteWithStale(func() (int, error) { return 3, nil })
+	assert.Equal(t, 1, result)
+	assert.True(t, stale)
+	assert.Nil(t, err)
+
+	cb.lastSuccessAt = cb.lastSuccessAt.Add(-time.Duration(11) * time.Second) // over LastSuccessTTL
+	result, stale, err = cb.ExecuteWithStale(func() (int, error) { return 3, nil })
+	assert.Equal(t, 0, result)
+	assert.False(t, stale)
+	assert.Equal(t, ErrOpenState, err)
+
+	// the result is not kept without LastSuccessTTL
+	cb = NewCircuitBreaker[int](Settings{})
+	_, _, err = cb.ExecuteWithStale(func() (int, error) { return 1, nil })
+	assert.Nil(t, err)
+	assert.True(t, cb.lastSuccessAt.IsZero())
+}
+
+func TestExecuteWithPreCheck(t *testing.T) {
+	cb := NewCircuitBreaker[[]string](Settings{})
+	preCheck := func(ctx context.Context) (bool, []string) {
+		keys, _ := ctx.Value(ctxKey{}).([]string)
+		return len(keys) == 0, []string{}
+	}
+	called := false
+	req := func(ctx context.Context) ([]string, error) {
+		called = true
+		return ctx.Value(ctxKey{}).([]string), nil
+	}
+
+	result, err := cb.ExecuteWithPreCheck(context.Background(), preCheck, req)
+	assert.Equal(t, []string{}, result)
+	assert.Nil(t, err)
+	assert.False(t, called)
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+	assert.Equal(t, Metrics{}, cb.Metrics())
+
+	ctx := context.WithValue(context.Background(), ctxKey{}, []string{"a"})
+	result, err = cb.ExecuteWithPreCheck(ctx, preCheck, req)
+	assert.Equal(t, []string{"a"}, result)
+	assert.Nil(t, err)
+	assert.True(t, called)
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0}, cb.Counts())
+
+	// the pre-check is consulted even while the CircuitBreaker is open
+	cb.setState(StateOpen, time.Now())
+	result, err = cb.ExecuteWithPreCheck(context.Background(), preCheck, req)
+	assert.Equal(t, []string{}, result)
+	assert.Nil(t, err)
+	_, err = cb.ExecuteWithPreCheck(ctx, nil, req)
+	assert.Equal(t, ErrOpenState, err)
+}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestConsecutiveTimeouts(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.ConsecutiveTimeouts >= 3
+		},
+	})
+	timeout := func(err error) error {
+		_, e := cb.Execute(func() (bool, error) { return false, err })
+		return e
+	}
+
+	assert.Equal(t, context.DeadlineExceeded, timeout(context.DeadlineExceeded))
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 1}, cb.counts)
+	assert.Error(t, timeout(fmt.Errorf("read: %w", os.ErrDeadlineExceeded)))
+	assert.Equal(t, Counts{2, 0, 2, 0, 2, 2}, cb.counts)
+
+	// other errors reset ConsecutiveTimeouts
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Counts{3, 0, 3, 0, 3, 0}, cb.counts)
+	assert.Equal(t, context.Canceled, timeout(context.Canceled))
+	assert.Equal(t, Counts{4, 0, 4, 0, 4, 0}, cb.counts)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, timeoutError{}, timeout(timeoutError{}))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{6, 0, 6, 0, 6, 2}, cb.counts)
+
+	// successes reset ConsecutiveTimeouts
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{7, 1, 6, 1, 0, 0}, cb.counts)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, context.DeadlineExceeded, timeout(context.DeadlineExceeded))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestOnApproachingTrip(t *testing.T) {
+	var warnings []float64
+	cb := NewCircuitBreaker[bool](Settings{
+		Name: "warn",
+		OnApproachingTrip: func(name string, counts Counts, fraction float64) {
+			assert.Equal(t, "warn", name)
+			assert.Equal(t, uint32(5), counts.ConsecutiveFailures)
+			warnings = append(warnings, fraction)
+		},
+	})
+
+	for i := 0; i < 4; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Empty(t, warnings)
+	assert.Nil(t, fail(cb)) // 5 of 6 consecutive failures
+	assert.Equal(t, []float64{5.0 / 6}, warnings)
+	assert.Equal(t, StateClosed, cb.State())
+
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, []float64{5.0 / 6}, warnings)
+
+	// a custom ReadyToTrip needs TripProgress
+	warnings = nil
+	cb = NewCircuitBreaker[bool](Settings{
+		ReadyToTrip: func(counts Counts) bool {
+			return counts.TotalFailures >= 4
+		},
+		TripProgress: func(counts Counts) float64 {
+			return float64(counts.TotalFailures) / 4
+		},
+		TripWarningFraction: 0.5,
+		OnApproachingTrip: func(name string, counts Counts, fraction float64) {
+			warnings = append(warnings, fraction)
+		},
+	})
+	assert.Nil(t, fail(cb))
+	assert.Empty(t, warnings)
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, []float64{0.5}, warnings)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestExecuteClassified(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	errPartial := errors.New("partial")
+
+	classified := func(err error, o Outcome) error {
+		_, e := cb.ExecuteClassified(func() (bool, error, Outcome) { return true, err, o })
+		return e
+	}
+
+	assert.Equal(t, errPartial, classified(errPartial, OutcomeSuccess))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0}, cb.Counts())
+
+	assert.Nil(t, classified(nil, OutcomeFailure))
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0}, cb.Counts())
+
+	assert.Equal(t, errPartial, classified(errPartial, OutcomeIgnore))
+	assert.Equal(t, Counts{3, 1, 1, 0, 1, 0}, cb.Counts())
+
+	_, err := cb.ExecuteClassified(nil)
+	assert.Equal(t, ErrNilRequest, err)
+}
+
+func TestExecuteClassifiedInHalfOpen(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{MaxRequests: 2})
+	cb.setState(StateHalfOpen, time.Now())
+
+	classified := func(o Outcome) error {
+		_, err := cb.ExecuteClassified(func() (bool, error, Outcome) { return true, nil, o })
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, classified(OutcomeIgnore))
+	}
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, cb.Counts())
+
+	assert.Nil(t, classified(OutcomeSuccess))
+	assert.Nil(t, classified(OutcomeIgnore))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0}, cb.Counts())
+	assert.Nil(t, classified(OutcomeSuccess))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+type admission struct {
+	name       string
+	state      State
+	generation uint64
+}
+
+func TestOnAllow(t *testing.T) {
+	var admissions []admission
+	cb := NewCircuitBreaker[bool](Settings{
+		Name: "allow",
+		OnAllow: func(name string, state State, generation uint64) {
+			admissions = append(admissions, admission{name, state, generation})
+		},
+	})
+	generation := cb.generation
+
+	assert.Nil(t, succeed(cb))
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, 7, len(admissions))
+	for _, a := range admissions {
+		assert.Equal(t, admission{"allow", StateClosed, generation}, a)
+	}
+
+	// rejected requests are not admitted
+	assert.Error(t, succeed(cb))
+	assert.Equal(t, 7, len(admissions))
+
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, 8, len(admissions))
+	assert.Equal(t, admission{"allow", StateHalfOpen, generation + 2}, admissions[7])
+}
+
+func TestUpdateSettings(t *testing.T) {
+	cb := newCustom()
+	assert.Nil(t, fail(cb))
+	generation := cb.generation
+
+	err := cb.UpdateSettings(Settings{Name: "cb", MaxRequests: 1, Timeout: time.Duration(10) * time.Second})
+	assert.Nil(t, err)
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, generation, cb.generation)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, cb.counts)
+
+	// the new Timeout is applied to the next open state
+	assert.Nil(t, fail(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+	pseudoSleep(cb, time.Duration(9)*time.Second)
+	assert.Equal(t, StateOpen, cb.State())
+	pseudoSleep(cb, time.Duration(1)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	// the new MaxRequests closes after 1 success
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	assert.EqualError(t, cb.UpdateSettings(Settings{Name: "other"}), `cannot change Name from "cb" to "other"`)
+	assert.EqualError(t, cb.UpdateSettings(Settings{Name: "cb", Timeout: -time.Second}), "negative Timeout: -1s")
+	assert.Equal(t, uint32(1), cb.maxRequests)
+}
+
+type traceIDKey struct{}
+
+func TestOnStateChangeWithID(t *testing.T) {
+	var ids []string
+	cb := NewCircuitBreaker[bool](Settings{
+		CorrelationIDKey: traceIDKey{},
+		OnStateChangeWithID: func(_ string, _ State, _ State, correlationID string) {
+			ids = append(ids, correlationID)
+		},
+	})
+
+	failWithID := func(id any) error {
+		ctx := context.WithValue(context.Background(), traceIDKey{}, id)
+		_, err := cb.ExecuteContext(ctx, func(context.Context) (bool, error) { return false, errors.New("fail") })
+		if err != nil && err.Error() == "fail" {
+			return nil
+		}
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, failWithID(fmt.Sprintf("trace-%d", i)))
+	}
+	assert.Nil(t, failWithID("trace-trip"))
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, []string{"trace-trip"}, ids)
+
+	// the transition into the half-open state is caused by the admitted request
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Nil(t, failWithID(42))
+	assert.Equal(t, []string{"trace-trip", "42", "42"}, ids)
+
+	cb.Reset()
+	assert.Equal(t, []string{"trace-trip", "42", "42", ""}, ids)
+}
+
+func TestCorrelationIDOnRejectAndLog(t *testing.T) {
+	var buf bytes.Buffer
+	var rejected []string
+	cb := NewCircuitBreaker[bool](Settings{
+		CorrelationIDKey:     traceIDKey{},
+		MinRemainingDeadline: time.Second,
+		Logger:               slog.New(slog.NewJSONHandler(&buf, nil)),
+		OnRejectWithID: func(_ string, reason RejectReason, correlationID string) {
+			rejected = append(rejected, reason.String()+":"+correlationID)
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		ctx := context.WithValue(context.Background(), traceIDKey{}, fmt.Sprintf("trace-%d", i))
+		_, _ = cb.ExecuteContext(ctx, func(context.Context) (bool, error) { return false, errors.New("fail") })
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	records := logRecords(t, &buf)
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "trace-5", records[0]["correlation_id"])
+
+	ctx := context.WithValue(context.Background(), traceIDKey{}, "trace-open")
+	_, err := cb.ExecuteContext(ctx, func(context.Context) (bool, error) { return true, nil })
+	assert.Equal(t, ErrOpenState, err)
+	ctx, cancel := context.WithTimeout(context.WithValue(context.Background(), traceIDKey{}, "trace-deadline"), time.Millisecond)
+	defer cancel()
+	_, err = cb.ExecuteContext(ctx, func(context.Context) (bool, error) { return true, nil })
+	assert.Equal(t, ErrDeadlineTooShort, err)
+	assert.Equal(t, ErrOpenState, fail(cb))
+	assert.Equal(t, []string{"open:trace-open", "deadline_too_short:trace-deadline", "open:"}, rejected)
+
+	// the administrative actions have no correlation ID
+	buf.Reset()
+	cb.Reset()
+	records = logRecords(t, &buf)
+	assert.Equal(t, 2, len(records))
+	for _, record := range records {
+		assert.NotContains(t, record, "correlation_id")
+	}
+}
+
+func TestMinRemainingDeadline(t *testing.T) {
+	var reasons []RejectReason
+	cb := NewCircuitBreaker[bool](Settings{
+		MinRemainingDeadline: time.Second,
+		OnReject:             func(_ string, reason RejectReason) { reasons = append(reasons, reason) },
+	})
+
+	called := false
+	req := func(context.Context) (bool, error) {
+		called = true
+		return true, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Millisecond)
+	defer cancel()
+	_, err := cb.ExecuteContext(ctx, req)
+	assert.Equal(t, ErrDeadlineTooShort, err)
+	assert.False(t, called)
+	assert.Equal(t, []RejectReason{RejectDeadlineTooShort}, reasons)
+	assert.Equal(t, Counts{}, cb.Counts())
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	_, err = cb.ExecuteContext(ctx, req)
+	assert.Nil(t, err)
+	assert.True(t, called)
+
+	// a context without a deadline is not checked
+	_, err = cb.ExecuteContext(context.Background(), req)
+	assert.Nil(t, err)
+	assert.Equal(t, Counts{2, 2, 0, 2, 0, 0}, cb.Counts())
+}
+
+func TestMinRemainingDeadlineRejectSerialized(t *testing.T) {
+	var inside, overlapped atomic.Bool
+	cb := NewCircuitBreaker[bool](Settings{
+		MinRemainingDeadline: time.Second,
+		OnReject: func(string, RejectReason) {
+			if inside.Swap(true) {
+				overlapped.Store(true)
+			}
+			time.Sleep(time.Millisecond)
+			inside.Store(false)
+		},
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(10)*time.Millisecond)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 5; j++ {
+				_, _ = cb.ExecuteContext(ctx, func(context.Context) (bool, error) { return true, nil })
+			}
+		}()
+	}
+	wg.Wait()
+	assert.False(t, overlapped.Load())
+	assert.Equal(t, uint64(20), cb.Metrics().Rejections)
+}
+
+func TestOnStateChangeMinInterval(t *testing.T) {
+	clock := gobreakertest.NewClock(time.Now())
+	var notified []StateChange
+	cb := NewCircuitBreaker[bool](Settings{
+		Clock:                    clock,
+		OnStateChangeMinInterval: time.Second,
+		OnStateChange: func(name string, from State, to State) {
+			notified = append(notified, StateChange{name, from, to})
+		},
+	})
+
+	flap := func() {
+		for i := 0; i < 6; i++ {
+			assert.Nil(t, fail(cb))
+		}
+		assert.Equal(t, StateOpen, cb.State())
+		cb.Reset()
+		assert.Equal(t, StateClosed, cb.State())
+	}
+
+	for i := 0; i < 5; i++ {
+		flap()
+	}
+	assert.Equal(t, []StateChange{
+		{"", StateClosed, StateOpen},
+		{"", StateOpen, StateClosed},
+	}, notified)
+	assert.Equal(t, uint64(10), cb.Metrics().StateChanges)
+
+	clock.Advance(time.Second)
+	flap()
+	flap()
+	assert.Equal(t, 4, len(notified))
+}
+
+func TestOnStateChangeMinIntervalPending(t *testing.T) {
+	clock := gobreakertest.NewClock(time.Now())
+	var notified []StateChange
+	cb := NewCircuitBreaker[bool](Settings{
+		Clock:                    clock,
+		OnStateChangeMinInterval: time.Second,
+		OnStateChange: func(name string, from State, to State) {
+			notified = append(notified, StateChange{name, from, to})
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	cb.setState(StateHalfOpen, clock.Now())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, []StateChange{
+		{"", StateClosed, StateOpen},
+		{"", StateOpen, StateHalfOpen},
+		{"", StateHalfOpen, StateClosed},
+	}, notified)
+
+	// the transition from the last notified state is delivered after the interval
+	clock.Advance(time.Second)
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, StateChange{"", StateClosed, StateOpen}, notified[len(notified)-1])
+	assert.Equal(t, 4, len(notified))
+
+	// the next transition is notified from the last notified state
+	cb.setState(StateHalfOpen, clock.Now())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, []StateChange{
+		{"", StateOpen, StateHalfOpen},
+		{"", StateHalfOpen, StateClosed},
+	}, notified[4:])
+	assert.False(t, cb.pending)
+}
+
+func TestHealthyLatencyThreshold(t *testing.T) {
+	clock := gobreakertest.NewClock(time.Now())
+	cb := NewCircuitBreaker[bool](Settings{
+		Clock:                   clock,
+		MaxRequests:             2,
+		HealthyLatencyThreshold: time.Duration(100) * time.Millisecond,
+	})
+	succeedIn := func(latency time.Duration) error {
+		_, err := cb.Execute(func() (bool, error) {
+			clock.Advance(latency)
+			return true, nil
+		})
+		return err
+	}
+
+	// slow successes don't matter in the closed state
+	assert.Nil(t, succeedIn(time.Second))
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	clock.Advance(time.Duration(61) * time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	generation := cb.generation
+
+	// a slow success starts the half-open state over
+	assert.Nil(t, succeedIn(time.Duration(10)*time.Millisecond))
+	assert.Nil(t, succeedIn(time.Duration(200)*time.Millisecond))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, generation+1, cb.generation)
+	assert.Equal(t, Counts{}, cb.Counts())
+
+	// fast successes close the CircuitBreaker
+	assert.Nil(t, succeedIn(time.Duration(10)*time.Millisecond))
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Nil(t, succeedIn(time.Duration(100)*time.Millisecond))
+	assert.Equal(t, StateClosed, cb.State())
+}
+
+// countingClock is a Clock that counts the reads of the time.
+type countingClock struct {
+	reads int
+}
+
+func (c *countingClock) Now() time.Time {
+	c.reads++
+	return time.Now()
+}
+
+func TestClockReads(t *testing.T) {
+	clock := &countingClock{}
+	cb := NewCircuitBreaker[bool](Settings{Clock: clock, EventTimelineSize: 10, LastSuccessTTL: time.Minute})
+
+	// an executed request reads the time at the admission and at the completion
+	clock.reads = 0
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, 2, clock.reads)
+
+	clock.reads = 0
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, 2, clock.reads)
+
+	// a rejected request reads the time only at the admission
+	cb.EnterMaintenance("")
+	clock.reads = 0
+	assert.Error(t, succeed(cb))
+	assert.Equal(t, 1, clock.reads)
 }
 
 func TestCircuitBreakerInParallel(t *testing.T) {
@@ -388,5 +1656,112 @@ func TestCircuitBreakerInParallel(t *testing.T) {
 		err := <-ch
 		assert.Nil(t, err)
 	}
-	assert.Equal(t, Counts{total, total, 0, total, 0}, customCB.counts)
+	assert.Equal(t, Counts{total, total, 0, total, 0, 0}, customCB.counts)
+}
+
+func TestFailOpenOn(t *testing.T) {
+	errAuth := errors.New("auth service unavailable")
+	cb := NewCircuitBreaker[bool](Settings{
+		FailOpenOn: func(err error) bool { return errors.Is(err, errAuth) },
+	})
+	assert.Nil(t, fail(cb))
+	assert.False(t, cb.FailOpen())
+
+	_, err := cb.Execute(func() (bool, error) { return false, errAuth })
+	assert.Equal(t, errAuth, err)
+	assert.True(t, cb.FailOpen())
+	assert.Equal(t, Counts{2, 0, 1, 0, 1, 0}, cb.Counts())
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Counts{12, 0, 1, 0, 1, 0}, cb.Counts())
+
+	cb.Reset()
+	assert.False(t, cb.FailOpen())
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestFailOpenOnWhileOpen(t *testing.T) {
+	errAuth := errors.New("auth service unavailable")
+	cb := NewCircuitBreaker[bool](Settings{
+		FailOpenOn: func(err error) bool { return errors.Is(err, errAuth) },
+	})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	cb.setState(StateClosed, time.Now())
+	_, err := cb.Execute(func() (bool, error) { return false, errAuth })
+	assert.Equal(t, errAuth, err)
+	cb.setState(StateOpen, time.Now())
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestFailOpenOnWithRateLimit(t *testing.T) {
+	errAuth := errors.New("auth service unavailable")
+	clock := gobreakertest.NewClock(time.Now())
+	cb := NewCircuitBreaker[bool](Settings{
+		Clock:      clock,
+		RateLimit:  10,
+		RateBurst:  10,
+		FailOpenOn: func(err error) bool { return errors.Is(err, errAuth) },
+	})
+	_, err := cb.Execute(func() (bool, error) { return false, errAuth })
+	assert.Equal(t, errAuth, err)
+
+	// failing open bypasses the rate limit without consuming tokens
+	for i := 0; i < 1000; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+
+	cb.Reset()
+	clock.Advance(time.Duration(10) * time.Second)
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, ErrRateLimited, succeed(cb))
+}
+
+func BenchmarkExecute(b *testing.B) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	req := func() (bool, error) { return true, nil }
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		_, _ = cb.Execute(req)
+	}
+}
+
+func BenchmarkExecuteParallel(b *testing.B) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	req := func() (bool, error) { return true, nil }
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_, _ = cb.Execute(req)
+		}
+	})
+}
+
+func BenchmarkTwoStepAllow(b *testing.B) {
+	cb := NewTwoStepCircuitBreaker[bool](Settings{})
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		done, err := cb.Allow()
+		if err == nil {
+			done(true)
+		}
+	}
 }
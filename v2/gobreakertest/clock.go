@@ -0,0 +1,37 @@
+// Package gobreakertest provides utilities for testing code that uses gobreaker.
+package gobreakertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock that implements gobreaker.Clock.
+// Its time advances only by Advance, so that tests can drive the Interval and the Timeout
+// of a CircuitBreaker without sleeping.
+// Set it to Settings.Clock of the CircuitBreaker under test.
+type Clock struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewClock returns a new Clock set to the given time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+// Now returns the current time of the Clock.
+func (c *Clock) Now() time.Time {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.now
+}
+
+// Advance moves the current time of the Clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.now = c.now.Add(d)
+}
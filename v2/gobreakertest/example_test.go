@@ -0,0 +1,42 @@
+package gobreakertest_test
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/sony/gobreaker/v2"
+	"github.com/sony/gobreaker/v2/gobreakertest"
+)
+
+func Example() {
+	clock := gobreakertest.NewClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cb := gobreaker.NewCircuitBreaker[string](gobreaker.Settings{
+		Name:    "example",
+		Timeout: 30 * time.Second,
+		Clock:   clock,
+		OnStateChange: func(name string, from gobreaker.State, to gobreaker.State) {
+			fmt.Printf("%s: %s -> %s\n", name, from, to)
+		},
+	})
+
+	fail := func() (string, error) { return "", errors.New("fail") }
+	succeed := func() (string, error) { return "ok", nil }
+
+	for i := 0; i < 6; i++ {
+		_, _ = cb.Execute(fail)
+	}
+	_, err := cb.Execute(succeed)
+	fmt.Println(err)
+
+	clock.Advance(31 * time.Second)
+	result, err := cb.Execute(succeed)
+	fmt.Println(result, err)
+
+	// Output:
+	// example: closed -> open
+	// circuit breaker is open
+	// example: open -> half-open
+	// example: half-open -> closed
+	// ok <nil>
+}
@@ -0,0 +1,92 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Breaker is the interface of CircuitBreaker and TwoStepCircuitBreaker
+// independent of the type of the results of requests.
+type Breaker interface {
+	Name() string
+	State() State
+	Counts() Counts
+	Reset()
+	Trip()
+}
+
+// Snapshot is the state and the internal Counts of a Breaker served by Handler.
+type Snapshot struct {
+	Name   string `json:"name"`
+	State  State  `json:"state"`
+	Counts Counts `json:"counts"`
+}
+
+func snapshotOf(b Breaker) Snapshot {
+	return Snapshot{Name: b.Name(), State: b.State(), Counts: b.Counts()}
+}
+
+// Handler is an http.Handler that serves the snapshots of Breakers in JSON.
+// On GET, Handler responds with the Snapshots of all the Breakers.
+// On POST with the form values name and action, Handler applies the action to the Breaker of the name
+// and responds with its Snapshot. The actions are "reset", which calls Reset, and "trip", which calls Trip.
+// POST is allowed only if Authorize returns true for the request; it is forbidden if Authorize is nil.
+type Handler struct {
+	Breakers  []Breaker
+	Authorize func(r *http.Request) bool
+}
+
+// NewHandler returns a new Handler serving the given Breakers, which allows no POST.
+func NewHandler(breakers ...Breaker) *Handler {
+	return &Handler{Breakers: breakers}
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		snapshots := make([]Snapshot, 0, len(h.Breakers))
+		for _, b := range h.Breakers {
+			snapshots = append(snapshots, snapshotOf(b))
+		}
+		writeJSON(w, snapshots)
+	case http.MethodPost:
+		h.serveAction(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) serveAction(w http.ResponseWriter, r *http.Request) {
+	if h.Authorize == nil || !h.Authorize(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	name := r.FormValue("name")
+	for _, b := range h.Breakers {
+		if b.Name() != name {
+			continue
+		}
+
+		switch action := r.FormValue("action"); action {
+		case "reset":
+			b.Reset()
+		case "trip":
+			b.Trip()
+		default:
+			http.Error(w, "unknown action: "+action, http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, snapshotOf(b))
+		return
+	}
+
+	http.Error(w, "unknown breaker: "+name, http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
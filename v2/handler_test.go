@@ -0,0 +1,79 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHandlerGet(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{Name: "cb"})
+	tscb := NewTwoStepCircuitBreaker[bool](Settings{Name: "tscb"})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Nil(t, succeed2Step(tscb))
+
+	rec := httptest.NewRecorder()
+	NewHandler(cb, tscb).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var snapshots []Snapshot
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &snapshots))
+	assert.Equal(t, []Snapshot{
+		{Name: "cb", State: StateOpen},
+		{Name: "tscb", State: StateClosed, Counts: Counts{1, 1, 0, 1, 0, 0}},
+	}, snapshots)
+	assert.Contains(t, rec.Body.String(), `"state":"open"`)
+}
+
+func TestHandlerPost(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{Name: "cb"})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+
+	post := func(h *Handler, form url.Values) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+	reset := url.Values{"name": {"cb"}, "action": {"reset"}}
+
+	// POST is forbidden without Authorize
+	h := NewHandler(cb)
+	assert.Equal(t, http.StatusForbidden, post(h, reset).Code)
+	h.Authorize = func(r *http.Request) bool { return r.Header.Get("X-Admin") != "" }
+	assert.Equal(t, http.StatusForbidden, post(h, reset).Code)
+	assert.Equal(t, StateOpen, cb.State())
+
+	h.Authorize = func(*http.Request) bool { return true }
+	assert.Equal(t, http.StatusNotFound, post(h, url.Values{"name": {"other"}, "action": {"reset"}}).Code)
+	assert.Equal(t, http.StatusBadRequest, post(h, url.Values{"name": {"cb"}, "action": {"close"}}).Code)
+	assert.Equal(t, StateOpen, cb.State())
+
+	rec := post(h, reset)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var snapshot Snapshot
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &snapshot))
+	assert.Equal(t, Snapshot{Name: "cb", State: StateClosed}, snapshot)
+	assert.Equal(t, StateClosed, cb.State())
+
+	rec = post(h, url.Values{"name": {"cb"}, "action": {"trip"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &snapshot))
+	assert.Equal(t, Snapshot{Name: "cb", State: StateOpen}, snapshot)
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, "/", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
@@ -0,0 +1,53 @@
+package gobreaker
+
+import (
+	"context"
+	"log/slog"
+)
+
+// LogValue implements slog.LogValuer.
+func (c Counts) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Uint64("requests", uint64(c.Requests)),
+		slog.Uint64("total_successes", uint64(c.TotalSuccesses)),
+		slog.Uint64("total_failures", uint64(c.TotalFailures)),
+		slog.Uint64("consecutive_successes", uint64(c.ConsecutiveSuccesses)),
+		slog.Uint64("consecutive_failures", uint64(c.ConsecutiveFailures)),
+		slog.Uint64("consecutive_timeouts", uint64(c.ConsecutiveTimeouts)),
+	)
+}
+
+// logStateChange logs the transition from prev to the current state,
+// with the Counts of the generation ended by the transition.
+func (cb *CircuitBreaker[T]) logStateChange(prev State, counts Counts) {
+	if cb.logger == nil {
+		return
+	}
+
+	attrs := []slog.Attr{
+		slog.String("name", cb.name),
+		slog.String("from", prev.String()),
+		slog.String("to", cb.state.String()),
+		slog.Uint64("generation", cb.generation),
+		slog.Any("counts", counts),
+	}
+	cb.logger.LogAttrs(context.Background(), slog.LevelInfo, "circuit breaker state changed", cb.withCause(attrs)...)
+}
+
+// logAction logs an administrative action applied to the CircuitBreaker.
+func (cb *CircuitBreaker[T]) logAction(action string, attrs ...slog.Attr) {
+	if cb.logger == nil {
+		return
+	}
+
+	attrs = append([]slog.Attr{slog.String("name", cb.name), slog.String("action", action)}, attrs...)
+	cb.logger.LogAttrs(context.Background(), slog.LevelInfo, "circuit breaker action", cb.withCause(attrs)...)
+}
+
+// withCause appends the correlation ID of the request being processed, if any, to attrs.
+func (cb *CircuitBreaker[T]) withCause(attrs []slog.Attr) []slog.Attr {
+	if cb.cause == "" {
+		return attrs
+	}
+	return append(attrs, slog.String("correlation_id", cb.cause))
+}
@@ -0,0 +1,62 @@
+package gobreaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// logRecords returns the JSON records written to buf without the times.
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]any
+		assert.Nil(t, json.Unmarshal([]byte(line), &record))
+		assert.NotEmpty(t, record["time"])
+		delete(record, "time")
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	cb := NewCircuitBreaker[bool](Settings{
+		Name:   "cb",
+		Logger: slog.New(slog.NewJSONHandler(&buf, nil)),
+	})
+
+	assert.Nil(t, succeed(cb))
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	cb.EnterMaintenance("upgrade")
+	cb.ExitMaintenance()
+	cb.Reset()
+
+	assert.Equal(t, []map[string]any{
+		{
+			"level": "INFO", "msg": "circuit breaker state changed",
+			"name": "cb", "from": "closed", "to": "open", "generation": float64(cb.generation - 1),
+			"counts": map[string]any{
+				"requests": float64(7), "total_successes": float64(1), "total_failures": float64(6),
+				"consecutive_successes": float64(0), "consecutive_failures": float64(6), "consecutive_timeouts": float64(0),
+			},
+		},
+		{"level": "INFO", "msg": "circuit breaker action", "name": "cb", "action": "enter_maintenance", "reason": "upgrade"},
+		{"level": "INFO", "msg": "circuit breaker action", "name": "cb", "action": "exit_maintenance"},
+		{"level": "INFO", "msg": "circuit breaker action", "name": "cb", "action": "reset"},
+		{
+			"level": "INFO", "msg": "circuit breaker state changed",
+			"name": "cb", "from": "open", "to": "closed", "generation": float64(cb.generation),
+			"counts": map[string]any{
+				"requests": float64(0), "total_successes": float64(0), "total_failures": float64(0),
+				"consecutive_successes": float64(0), "consecutive_failures": float64(0), "consecutive_timeouts": float64(0),
+			},
+		},
+	}, logRecords(t, &buf))
+}
@@ -0,0 +1,58 @@
+package gobreaker
+
+import (
+	"errors"
+	"log/slog"
+)
+
+// ErrMaintenance is returned, wrapped in MaintenanceError, when the CB is in maintenance mode
+var ErrMaintenance = errors.New("maintenance")
+
+// MaintenanceError is the error returned for the requests rejected in maintenance mode.
+// It carries the reason given to EnterMaintenance, and errors.Is reports it as ErrMaintenance.
+type MaintenanceError struct {
+	Reason string
+}
+
+func (e *MaintenanceError) Error() string {
+	if e.Reason == "" {
+		return ErrMaintenance.Error()
+	}
+	return ErrMaintenance.Error() + ": " + e.Reason
+}
+
+// Is reports whether target is ErrMaintenance.
+func (e *MaintenanceError) Is(target error) bool {
+	return target == ErrMaintenance
+}
+
+// EnterMaintenance places the CircuitBreaker into maintenance mode with the given reason,
+// in which it rejects all requests with a MaintenanceError without running them.
+// Maintenance mode is independent of the state: the state and the internal Counts are kept,
+// and the CircuitBreaker stays in maintenance mode until ExitMaintenance is called.
+func (cb *CircuitBreaker[T]) EnterMaintenance(reason string) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.maintenance = &MaintenanceError{Reason: reason}
+	cb.logAction("enter_maintenance", slog.String("reason", reason))
+}
+
+// ExitMaintenance takes the CircuitBreaker out of maintenance mode.
+func (cb *CircuitBreaker[T]) ExitMaintenance() {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	cb.maintenance = nil
+	cb.logAction("exit_maintenance")
+}
+
+// EnterMaintenance places the TwoStepCircuitBreaker into maintenance mode as CircuitBreaker.EnterMaintenance does.
+func (tscb *TwoStepCircuitBreaker[T]) EnterMaintenance(reason string) {
+	tscb.cb.EnterMaintenance(reason)
+}
+
+// ExitMaintenance takes the TwoStepCircuitBreaker out of maintenance mode.
+func (tscb *TwoStepCircuitBreaker[T]) ExitMaintenance() {
+	tscb.cb.ExitMaintenance()
+}
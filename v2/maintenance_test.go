@@ -0,0 +1,63 @@
+package gobreaker
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenance(t *testing.T) {
+	var reasons []RejectReason
+	cb := NewCircuitBreaker[bool](Settings{
+		OnReject: func(_ string, reason RejectReason) { reasons = append(reasons, reason) },
+	})
+	assert.Nil(t, fail(cb))
+
+	cb.EnterMaintenance("database upgrade")
+	called := false
+	_, err := cb.Execute(func() (bool, error) {
+		called = true
+		return true, nil
+	})
+	assert.False(t, called)
+	assert.True(t, errors.Is(err, ErrMaintenance))
+	assert.True(t, IsBreakerError(err))
+	assert.EqualError(t, err, "maintenance: database upgrade")
+	var me *MaintenanceError
+	assert.True(t, errors.As(err, &me))
+	assert.Equal(t, "database upgrade", me.Reason)
+	assert.Equal(t, []RejectReason{RejectMaintenance}, reasons)
+
+	allowed, state := cb.WouldAllow()
+	assert.False(t, allowed)
+	assert.Equal(t, StateClosed, state)
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, cb.Counts())
+
+	cb.ExitMaintenance()
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{2, 1, 1, 1, 0, 0}, cb.Counts())
+}
+
+func TestMaintenanceNoRecovery(t *testing.T) {
+	cb := NewTwoStepCircuitBreaker[bool](Settings{})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail2Step(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+
+	cb.EnterMaintenance("")
+	pseudoSleep(cb.cb, time.Duration(61)*time.Second)
+	_, err := cb.Allow()
+	assert.EqualError(t, err, "maintenance")
+
+	// the state recovers underneath, but the requests are still rejected
+	assert.Equal(t, StateHalfOpen, cb.State())
+	_, err = cb.Allow()
+	assert.True(t, errors.Is(err, ErrMaintenance))
+
+	cb.ExitMaintenance()
+	assert.Nil(t, succeed2Step(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
@@ -0,0 +1,36 @@
+package gobreaker
+
+import "sync/atomic"
+
+// Metrics holds the numbers of requests and events counted since CircuitBreaker was created.
+// LoadSheds is the number of the Rejections for reasons of load shedding.
+// Unlike Counts, Metrics is never cleared.
+type Metrics struct {
+	Requests     uint64
+	Successes    uint64
+	Failures     uint64
+	Rejections   uint64
+	LoadSheds    uint64
+	StateChanges uint64
+}
+
+// metrics maintains Metrics with atomic counters.
+type metrics struct {
+	requests     atomic.Uint64
+	successes    atomic.Uint64
+	failures     atomic.Uint64
+	rejections   atomic.Uint64
+	loadSheds    atomic.Uint64
+	stateChanges atomic.Uint64
+}
+
+func (m *metrics) snapshot() Metrics {
+	return Metrics{
+		Requests:     m.requests.Load(),
+		Successes:    m.successes.Load(),
+		Failures:     m.failures.Load(),
+		Rejections:   m.rejections.Load(),
+		LoadSheds:    m.loadSheds.Load(),
+		StateChanges: m.stateChanges.Load(),
+	}
+}
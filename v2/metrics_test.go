@@ -0,0 +1,70 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	assert.Equal(t, Metrics{}, cb.Metrics())
+
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, Metrics{Requests: 2, Successes: 1, Failures: 1}, cb.Metrics())
+
+	// StateClosed to StateOpen
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Error(t, succeed(cb))
+	assert.Error(t, fail(cb))
+	assert.Equal(t, Metrics{Requests: 7, Successes: 1, Failures: 6, Rejections: 2, StateChanges: 1}, cb.Metrics())
+
+	// StateOpen to StateHalfOpen to StateClosed
+	pseudoSleep(cb, time.Duration(60)*time.Second)
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Equal(t, Metrics{Requests: 8, Successes: 2, Failures: 6, Rejections: 2, StateChanges: 3}, cb.Metrics())
+}
+
+func TestLoadShed(t *testing.T) {
+	assert.False(t, RejectOpen.LoadShed())
+	assert.False(t, RejectTooManyRequests.LoadShed())
+	assert.True(t, RejectRateLimited.LoadShed())
+	assert.True(t, RejectLowPriority.LoadShed())
+	assert.True(t, RejectBulkheadFull.LoadShed())
+	assert.False(t, RejectDeadlineTooShort.LoadShed())
+	assert.False(t, RejectMaintenance.LoadShed())
+
+	var rejected, shed []RejectReason
+	cb := NewCircuitBreaker[bool](Settings{
+		MaxConcurrent: 1,
+		OnReject:      func(_ string, reason RejectReason) { rejected = append(rejected, reason) },
+		OnLoadShed:    func(_ string, reason RejectReason) { shed = append(shed, reason) },
+	})
+
+	// a concurrency rejection is load shedding
+	release := make(chan struct{})
+	ch := occupy(cb, release)
+	assert.Equal(t, ErrBulkheadFull, succeed(cb))
+	close(release)
+	assert.Nil(t, <-ch)
+	assert.Equal(t, []RejectReason{RejectBulkheadFull}, rejected)
+	assert.Equal(t, []RejectReason{RejectBulkheadFull}, shed)
+
+	// an open rejection is not
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, ErrOpenState, succeed(cb))
+	assert.Equal(t, []RejectReason{RejectBulkheadFull, RejectOpen}, rejected)
+	assert.Equal(t, []RejectReason{RejectBulkheadFull}, shed)
+
+	metrics := cb.Metrics()
+	assert.Equal(t, uint64(2), metrics.Rejections)
+	assert.Equal(t, uint64(1), metrics.LoadSheds)
+}
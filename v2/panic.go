@@ -0,0 +1,30 @@
+package gobreaker
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrPanic is returned, wrapped in PanicError, when a request panics and RecoverPanics is set
+var ErrPanic = errors.New("panic")
+
+// PanicError is the error returned for the requests that panicked when RecoverPanics is set.
+// It carries the recovered value, and errors.Is reports it as ErrPanic.
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s: %v", ErrPanic.Error(), e.Value)
+}
+
+// Is reports whether target is ErrPanic.
+func (e *PanicError) Is(target error) bool {
+	return target == ErrPanic
+}
+
+// Unwrap returns the recovered value if it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
@@ -0,0 +1,125 @@
+package gobreaker
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+)
+
+// MarshalJSON implements json.Marshaler.
+// State is encoded as its name, such as "half-open".
+func (s State) MarshalJSON() ([]byte, error) {
+	switch s {
+	case StateClosed, StateHalfOpen, StateOpen, StateDegraded:
+		return json.Marshal(s.String())
+	default:
+		return nil, fmt.Errorf("invalid state: %d", s)
+	}
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// It accepts both the name of a state and the integer form of older encodings.
+func (s *State) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var n int
+		if json.Unmarshal(data, &n) != nil {
+			return fmt.Errorf("invalid state: %s", data)
+		}
+		*s = State(n)
+		return nil
+	}
+
+	for _, state := range []State{StateClosed, StateHalfOpen, StateOpen, StateDegraded} {
+		if name == state.String() {
+			*s = state
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid state: %q", name)
+}
+
+// savedState is the form in which SaveState writes the state of CircuitBreaker.
+type savedState struct {
+	State      State     `json:"state"`
+	Generation uint64    `json:"generation"`
+	Counts     Counts    `json:"counts"`
+	Expiry     time.Time `json:"expiry"`
+}
+
+// SaveState writes the state, the generation, the internal Counts and the expiry of the CircuitBreaker to w
+// in JSON, so that LoadState can restore them, e.g. after a restart of the process.
+func (cb *CircuitBreaker[T]) SaveState(w io.Writer) error {
+	cb.mutex.Lock()
+	state, generation := cb.currentState(cb.clock.Now())
+	saved := savedState{
+		State:      state,
+		Generation: generation,
+		Counts:     cb.counts,
+		Expiry:     cb.expiry,
+	}
+	cb.mutex.Unlock()
+
+	return json.NewEncoder(w).Encode(saved)
+}
+
+// LoadState restores the state of the CircuitBreaker written by SaveState from r.
+// The expiry is validated against the current time and the current Settings:
+// an expiry further away than Interval or Timeout from now is shortened to it.
+// The requests sent before LoadState are ignored as the requests sent before clearing.
+// The degraded state is restored as the closed state if ReadyToDegrade is nil.
+// The half-open state is restored with cleared Counts, since the probes in flight at SaveState never complete.
+// LoadState doesn't call OnStateChange.
+func (cb *CircuitBreaker[T]) LoadState(r io.Reader) error {
+	var saved savedState
+	if err := json.NewDecoder(r).Decode(&saved); err != nil {
+		return err
+	}
+
+	switch saved.State {
+	case StateClosed, StateHalfOpen, StateOpen, StateDegraded:
+	default:
+		return fmt.Errorf("invalid saved state: %v", saved.State)
+	}
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if saved.State == StateDegraded && cb.readyToDegrade == nil {
+		saved.State = StateClosed
+	}
+
+	now := cb.clock.Now()
+	cb.logAction("load_state", slog.String("state", saved.State.String()))
+	cb.state = saved.State
+	cb.toNewGeneration(now)
+	if saved.Generation > cb.generation {
+		cb.generation = saved.Generation
+	}
+	if cb.state != StateHalfOpen {
+		cb.counts = saved.Counts
+	}
+
+	switch cb.state {
+	case StateClosed, StateDegraded:
+		if !cb.expiry.IsZero() && saved.Expiry.Before(cb.expiry) {
+			cb.expiry = saved.Expiry
+		}
+	case StateOpen:
+		if saved.Expiry.Before(cb.expiry) {
+			cb.expiry = saved.Expiry
+		}
+		if cb.probeSchedule > 0 {
+			cb.scheduleProbe(cb.generation)
+		}
+	case StateHalfOpen:
+		cb.halfOpenSince = now
+		if cb.probeFunc != nil {
+			go cb.probe(cb.generation)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package gobreaker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateJSON(t *testing.T) {
+	for _, state := range []State{StateClosed, StateHalfOpen, StateOpen, StateDegraded} {
+		data, err := json.Marshal(state)
+		assert.Nil(t, err)
+		assert.Equal(t, `"`+state.String()+`"`, string(data))
+
+		var decoded State
+		assert.Nil(t, json.Unmarshal(data, &decoded))
+		assert.Equal(t, state, decoded)
+
+		// the legacy integer form
+		decoded = State(100)
+		assert.Nil(t, json.Unmarshal([]byte(fmt.Sprint(int(state))), &decoded))
+		assert.Equal(t, state, decoded)
+	}
+
+	_, err := json.Marshal(State(100))
+	assert.Error(t, err)
+
+	var decoded State
+	assert.EqualError(t, json.Unmarshal([]byte(`"unknown"`), &decoded), `invalid state: "unknown"`)
+	assert.EqualError(t, json.Unmarshal([]byte(`true`), &decoded), "invalid state: true")
+}
+
+func TestSaveLoadState(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{})
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(20)*time.Second)
+	assert.Equal(t, StateOpen, cb.State())
+
+	var buf bytes.Buffer
+	assert.Nil(t, cb.SaveState(&buf))
+
+	restored := NewCircuitBreaker[bool](Settings{})
+	assert.Nil(t, restored.LoadState(&buf))
+	assert.Equal(t, StateOpen, restored.State())
+	assert.True(t, restored.generation >= cb.generation)
+	assert.Equal(t, cb.expiry.Unix(), restored.expiry.Unix())
+	assert.Error(t, succeed(restored))
+
+	// the remaining timeout is preserved
+	pseudoSleep(restored, time.Duration(39)*time.Second)
+	assert.Equal(t, StateOpen, restored.State())
+	pseudoSleep(restored, time.Duration(1)*time.Second)
+	assert.Equal(t, StateHalfOpen, restored.State())
+}
+
+func TestLoadStateValidation(t *testing.T) {
+	cb := newCustom()
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+
+	var buf bytes.Buffer
+	assert.Nil(t, cb.SaveState(&buf))
+	restored := newCustom()
+	assert.Nil(t, restored.LoadState(&buf))
+	assert.Equal(t, StateClosed, restored.State())
+	assert.Equal(t, Counts{2, 1, 1, 0, 1, 0}, restored.counts)
+
+	// an expiry far in the future is shortened to Timeout
+	far := time.Now().Add(time.Duration(24) * time.Hour).Format(time.RFC3339Nano)
+	err := restored.LoadState(strings.NewReader(`{"state":2,"generation":1,"expiry":"` + far + `"}`))
+	assert.Nil(t, err)
+	assert.Equal(t, StateOpen, restored.State())
+	assert.True(t, restored.expiry.Before(time.Now().Add(time.Duration(91)*time.Second)))
+
+	assert.Error(t, restored.LoadState(strings.NewReader(`{"state":100}`)))
+	assert.Error(t, restored.LoadState(strings.NewReader(`not json`)))
+	assert.Equal(t, StateOpen, restored.State())
+}
+
+func TestSaveLoadHalfOpenState(t *testing.T) {
+	cb := NewTwoStepCircuitBreaker[bool](Settings{MaxRequests: 2})
+	cb.cb.setState(StateHalfOpen, time.Now())
+	_, err := cb.Allow()
+	assert.Nil(t, err)
+	_, err = cb.Allow()
+	assert.Nil(t, err)
+	assert.Equal(t, Counts{2, 0, 0, 0, 0, 0}, cb.Counts())
+
+	var buf bytes.Buffer
+	assert.Nil(t, cb.cb.SaveState(&buf))
+
+	// the probes in flight are not restored
+	restored := NewTwoStepCircuitBreaker[bool](Settings{MaxRequests: 2})
+	assert.Nil(t, restored.cb.LoadState(&buf))
+	assert.Equal(t, StateHalfOpen, restored.State())
+	assert.Equal(t, Counts{0, 0, 0, 0, 0, 0}, restored.Counts())
+
+	assert.Nil(t, succeed2Step(restored))
+	assert.Nil(t, succeed2Step(restored))
+	assert.Equal(t, StateClosed, restored.State())
+}
+
+func TestLoadStateDegraded(t *testing.T) {
+	saved := `{"state":"degraded","generation":1,"counts":{"Requests":2,"TotalFailures":2,"ConsecutiveFailures":2}}`
+
+	// the degraded state is restored as the closed state without ReadyToDegrade
+	cb := NewCircuitBreaker[bool](Settings{})
+	assert.Nil(t, cb.LoadState(strings.NewReader(saved)))
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	cb = NewCircuitBreaker[bool](Settings{
+		ReadyToDegrade: func(counts Counts) bool { return counts.ConsecutiveFailures >= 2 },
+	})
+	assert.Nil(t, cb.LoadState(strings.NewReader(saved)))
+	assert.Equal(t, StateDegraded, cb.State())
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, StateClosed, cb.State())
+}
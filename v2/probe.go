@@ -0,0 +1,61 @@
+package gobreaker
+
+import (
+	"context"
+	"time"
+)
+
+// probe runs ProbeFunc in place of real requests in the half-open state of the given generation
+// and places the CircuitBreaker into the closed state if the probe succeeds, or the open state otherwise.
+func (cb *CircuitBreaker[T]) probe(generation uint64) {
+	ctx := context.Background()
+	if cb.probeTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cb.probeTimeout)
+		defer cancel()
+	}
+
+	err := cb.runProbe(ctx)
+	timeout := err != nil && cb.isTimeout(err)
+
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if cb.state != StateHalfOpen || cb.generation != generation {
+		return
+	}
+
+	now := cb.clock.Now()
+	if err == nil {
+		cb.setState(StateClosed, now)
+	} else {
+		cb.onFailure(StateHalfOpen, now, err, timeout)
+	}
+}
+
+// scheduleProbe runs ProbeFunc after ProbeSchedule if the CircuitBreaker is still open in the given generation.
+func (cb *CircuitBreaker[T]) scheduleProbe(generation uint64) {
+	time.AfterFunc(cb.probeSchedule, func() {
+		cb.mutex.Lock()
+		if cb.state != StateOpen || cb.generation != generation || cb.manualResetOnly {
+			cb.mutex.Unlock()
+			return
+		}
+		cb.setState(StateHalfOpen, cb.clock.Now())
+		generation := cb.generation
+		cb.mutex.Unlock()
+
+		cb.probe(generation)
+	})
+}
+
+// runProbe runs ProbeFunc with ctx and returns a panic in it as a PanicError.
+func (cb *CircuitBreaker[T]) runProbe(ctx context.Context) (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = &PanicError{Value: e}
+		}
+	}()
+
+	return cb.probeFunc(ctx)
+}
@@ -0,0 +1,143 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProbeFunc(t *testing.T) {
+	probes := make(chan chan error)
+	stateChanges := make(chan StateChange, 10)
+	cb := NewCircuitBreaker[bool](Settings{
+		Timeout: time.Duration(10) * time.Second,
+		ProbeFunc: func(ctx context.Context) error {
+			result := make(chan error)
+			probes <- result
+			return <-result
+		},
+		OnStateChange: func(name string, from State, to State) {
+			stateChanges <- StateChange{name, from, to}
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateChange{"", StateClosed, StateOpen}, <-stateChanges)
+
+	// the user requests are rejected while the probe runs
+	pseudoSleep(cb, time.Duration(11)*time.Second)
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	assert.Equal(t, StateChange{"", StateOpen, StateHalfOpen}, <-stateChanges)
+	result := <-probes
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+
+	// the failed probe reopens the CircuitBreaker
+	result <- errors.New("fail")
+	assert.Equal(t, StateChange{"", StateHalfOpen, StateOpen}, <-stateChanges)
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	// the next probe runs after Timeout and closes the CircuitBreaker
+	pseudoSleep(cb, time.Duration(11)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+	assert.Equal(t, StateChange{"", StateOpen, StateHalfOpen}, <-stateChanges)
+	result = <-probes
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	result <- nil
+	assert.Equal(t, StateChange{"", StateHalfOpen, StateClosed}, <-stateChanges)
+
+	assert.Nil(t, succeed(cb))
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0}, cb.Counts())
+}
+
+func TestProbeTimeout(t *testing.T) {
+	done := make(chan error)
+	cb := NewCircuitBreaker[bool](Settings{
+		ProbeTimeout: time.Duration(10) * time.Millisecond,
+		ProbeFunc: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+		OnStateChange: func(_ string, from State, to State) {
+			if from == StateHalfOpen {
+				done <- nil
+			}
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(61)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	<-done
+	assert.Equal(t, StateOpen, cb.State())
+	assert.Equal(t, context.DeadlineExceeded, cb.LastTripError())
+}
+
+func TestProbePanic(t *testing.T) {
+	done := make(chan struct{})
+	cb := NewCircuitBreaker[bool](Settings{
+		ProbeFunc: func(ctx context.Context) error { panic("oops") },
+		OnStateChange: func(_ string, from State, to State) {
+			if from == StateHalfOpen {
+				close(done)
+			}
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	pseudoSleep(cb, time.Duration(61)*time.Second)
+	assert.Equal(t, StateHalfOpen, cb.State())
+
+	<-done
+	assert.Equal(t, StateOpen, cb.State())
+	assert.True(t, errors.Is(cb.LastTripError(), ErrPanic))
+}
+
+func TestProbeSchedule(t *testing.T) {
+	probes := make(chan chan error)
+	stateChanges := make(chan StateChange, 10)
+	cb := NewCircuitBreaker[bool](Settings{
+		ProbeSchedule: time.Duration(10) * time.Millisecond,
+		ProbeFunc: func(ctx context.Context) error {
+			result := make(chan error)
+			probes <- result
+			return <-result
+		},
+		OnStateChange: func(name string, from State, to State) {
+			stateChanges <- StateChange{name, from, to}
+		},
+	})
+
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateChange{"", StateClosed, StateOpen}, <-stateChanges)
+
+	// the probe runs on schedule without a use of the CircuitBreaker within Timeout
+	result := <-probes
+	assert.Equal(t, StateChange{"", StateOpen, StateHalfOpen}, <-stateChanges)
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	result <- errors.New("fail")
+	assert.Equal(t, StateChange{"", StateHalfOpen, StateOpen}, <-stateChanges)
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	// the user requests stay rejected until the scheduled probe succeeds
+	result = <-probes
+	assert.Equal(t, StateChange{"", StateOpen, StateHalfOpen}, <-stateChanges)
+	assert.Equal(t, ErrTooManyRequests, succeed(cb))
+	result <- nil
+	assert.Equal(t, StateChange{"", StateHalfOpen, StateClosed}, <-stateChanges)
+	assert.Nil(t, succeed(cb))
+
+	err := Settings{ProbeSchedule: time.Second}.Validate()
+	assert.EqualError(t, err, "ProbeSchedule without ProbeFunc")
+}
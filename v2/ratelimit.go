@@ -0,0 +1,42 @@
+package gobreaker
+
+import "time"
+
+// tokenBucket limits the rate of requests with the token bucket algorithm.
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst uint32, now time.Time) *tokenBucket {
+	if burst == 0 {
+		burst = 1
+	}
+
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now,
+	}
+}
+
+// ready reports whether a request can proceed at now without consuming a token.
+func (b *tokenBucket) ready(now time.Time) bool {
+	if now.After(b.last) {
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+
+	return b.tokens >= 1
+}
+
+// take consumes a token.
+func (b *tokenBucket) take() {
+	b.tokens--
+}
@@ -0,0 +1,62 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	b := newTokenBucket(10, 0, now)
+	assert.Equal(t, float64(1), b.burst)
+
+	// 10 requests per second admit no more than 10 requests over a second
+	admitted := 0
+	for i := 0; i < 100; i++ {
+		if b.ready(now.Add(time.Duration(i) * 10 * time.Millisecond)) {
+			b.take()
+			admitted++
+		}
+	}
+	assert.Equal(t, 10, admitted)
+
+	b = newTokenBucket(10, 5, now)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.ready(now))
+		b.take()
+	}
+	assert.False(t, b.ready(now))
+
+	// the tokens never exceed the burst
+	later := now.Add(time.Duration(10) * time.Second)
+	for i := 0; i < 5; i++ {
+		assert.True(t, b.ready(later))
+		b.take()
+	}
+	assert.False(t, b.ready(later))
+
+	// ready doesn't consume a token
+	b = newTokenBucket(10, 1, now)
+	assert.True(t, b.ready(now))
+	assert.True(t, b.ready(now))
+	b.take()
+	assert.False(t, b.ready(now))
+}
+
+func TestRateLimit(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{RateLimit: 1, RateBurst: 3})
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, succeed(cb))
+	}
+	assert.Equal(t, ErrRateLimited, succeed(cb))
+	assert.Equal(t, ErrRateLimited, fail(cb))
+	assert.Equal(t, Counts{3, 3, 0, 3, 0, 0}, cb.counts)
+
+	cb.limiter.last = cb.limiter.last.Add(-time.Duration(1) * time.Second)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, ErrRateLimited, fail(cb))
+	assert.Equal(t, Counts{4, 3, 1, 0, 1, 0}, cb.counts)
+}
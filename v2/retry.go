@@ -0,0 +1,30 @@
+package gobreaker
+
+import "errors"
+
+// retryableError is an error of a request annotated by RetryableClassifier.
+type retryableError struct {
+	err       error
+	retryable bool
+}
+
+func (e *retryableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableError) Unwrap() error {
+	return e.err
+}
+
+// IsRetryable reports whether err, or any error it wraps, is an error of a request
+// that RetryableClassifier of the CircuitBreaker judged retryable.
+// It returns false for the errors that are not annotated, including the errors of CircuitBreaker.
+func IsRetryable(err error) bool {
+	var re *retryableError
+	return errors.As(err, &re) && re.retryable
+}
+
+// DefaultRetryableClassifier judges the timeouts retryable as default IsTimeout does.
+func DefaultRetryableClassifier(err error) bool {
+	return defaultIsTimeout(err)
+}
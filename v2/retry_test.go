@@ -0,0 +1,57 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetryableClassifier(t *testing.T) {
+	errValidation := errors.New("validation")
+	cb := NewCircuitBreaker[bool](Settings{RetryableClassifier: DefaultRetryableClassifier})
+
+	execute := func(err error) error {
+		_, e := cb.Execute(func() (bool, error) { return false, err })
+		return e
+	}
+
+	err := execute(context.DeadlineExceeded)
+	assert.True(t, IsRetryable(err))
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, context.DeadlineExceeded.Error(), err.Error())
+
+	err = execute(errValidation)
+	assert.False(t, IsRetryable(err))
+	assert.True(t, errors.Is(err, errValidation))
+	assert.False(t, IsBreakerError(err))
+
+	assert.Nil(t, execute(nil))
+	assert.Equal(t, Counts{3, 1, 2, 1, 0, 0}, cb.Counts())
+
+	// the errors of CircuitBreaker are not annotated
+	for i := 0; i < 6; i++ {
+		_ = execute(errValidation)
+	}
+	err = execute(nil)
+	assert.Equal(t, ErrOpenState, err)
+	assert.False(t, IsRetryable(err))
+}
+
+func TestCustomRetryableClassifier(t *testing.T) {
+	errUnavailable := errors.New("unavailable")
+	cb := NewCircuitBreaker[bool](Settings{
+		RetryableClassifier: func(err error) bool { return errors.Is(err, errUnavailable) },
+	})
+
+	_, err := cb.Execute(func() (bool, error) { return false, errUnavailable })
+	assert.True(t, IsRetryable(err))
+	_, err = cb.Execute(func() (bool, error) { return false, context.DeadlineExceeded })
+	assert.False(t, IsRetryable(err))
+
+	// the errors are returned as they are without RetryableClassifier
+	_, err = NewCircuitBreaker[bool](Settings{}).Execute(func() (bool, error) { return false, errUnavailable })
+	assert.Equal(t, errUnavailable, err)
+	assert.False(t, IsRetryable(err))
+}
@@ -0,0 +1,79 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// errLeaderPanicked is shared with the followers whose leader request panicked.
+var errLeaderPanicked = errors.New("single flight leader panicked")
+
+// flight is a request in flight shared by the callers with the same key.
+type flight[T any] struct {
+	done   chan struct{}
+	result T
+	err    error
+	dups   int
+}
+
+// flightGroup holds the requests in flight by key.
+type flightGroup[T any] struct {
+	mutex   sync.Mutex
+	flights map[string]*flight[T]
+}
+
+// join returns the flight for key and whether the caller leads it.
+func (g *flightGroup[T]) join(key string) (*flight[T], bool) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if f, ok := g.flights[key]; ok {
+		f.dups++
+		return f, false
+	}
+
+	if g.flights == nil {
+		g.flights = make(map[string]*flight[T])
+	}
+	f := &flight[T]{done: make(chan struct{}), err: errLeaderPanicked}
+	g.flights[key] = f
+	return f, true
+}
+
+// land completes the flight for key and releases its followers.
+func (g *flightGroup[T]) land(key string, f *flight[T]) {
+	g.mutex.Lock()
+	delete(g.flights, key)
+	g.mutex.Unlock()
+
+	close(f.done)
+}
+
+// ExecuteSingleFlight is like Execute but coalesces the concurrent calls with the same key.
+// Only the first caller, the leader, runs the given request through the CircuitBreaker,
+// so the request is counted once, and the other callers share its value and error.
+// If ctx is done before the leader completes, a follower gets the error of ctx instead.
+// A panic in the request is not recovered for the leader and fails the followers.
+func (cb *CircuitBreaker[T]) ExecuteSingleFlight(ctx context.Context, key string, req func() (T, error)) (T, error) {
+	if req == nil {
+		var defaultValue T
+		return defaultValue, ErrNilRequest
+	}
+
+	f, leader := cb.flights.join(key)
+	if leader {
+		defer cb.flights.land(key, f)
+
+		f.result, f.err = cb.Execute(req)
+		return f.result, f.err
+	}
+
+	select {
+	case <-f.done:
+		return f.result, f.err
+	case <-ctx.Done():
+		var defaultValue T
+		return defaultValue, ctx.Err()
+	}
+}
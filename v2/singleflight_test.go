@@ -0,0 +1,89 @@
+package gobreaker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecuteSingleFlight(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	const n = 10
+	var calls atomic.Int32
+	release := make(chan struct{})
+	req := func() (int, error) {
+		calls.Add(1)
+		<-release
+		return 42, nil
+	}
+
+	var wg sync.WaitGroup
+	results := make([]int, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = cb.ExecuteSingleFlight(context.Background(), "key", req)
+		}(i)
+	}
+
+	// wait until all the followers have joined the leader's flight
+	for {
+		cb.flights.mutex.Lock()
+		f := cb.flights.flights["key"]
+		joined := f != nil && f.dups == n-1
+		cb.flights.mutex.Unlock()
+		if joined {
+			break
+		}
+	}
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(1), calls.Load())
+	for i := 0; i < n; i++ {
+		assert.Equal(t, 42, results[i])
+		assert.Nil(t, errs[i])
+	}
+	assert.Equal(t, Counts{1, 1, 0, 1, 0, 0}, cb.Counts())
+
+	// the flight is over, so the next call runs the request again
+	result, err := cb.ExecuteSingleFlight(context.Background(), "key", func() (int, error) { return 1, nil })
+	assert.Equal(t, 1, result)
+	assert.Nil(t, err)
+
+	_, err = cb.ExecuteSingleFlight(context.Background(), "key", nil)
+	assert.Equal(t, ErrNilRequest, err)
+}
+
+func TestExecuteSingleFlightFollowerCanceled(t *testing.T) {
+	cb := NewCircuitBreaker[int](Settings{})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	leader := make(chan error, 1)
+	go func() {
+		_, err := cb.ExecuteSingleFlight(context.Background(), "key", func() (int, error) {
+			close(started)
+			<-release
+			return 0, errors.New("fail")
+		})
+		leader <- err
+	}()
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := cb.ExecuteSingleFlight(ctx, "key", func() (int, error) { return 1, nil })
+	assert.Equal(t, context.Canceled, err)
+
+	close(release)
+	assert.EqualError(t, <-leader, "fail")
+	assert.Equal(t, Counts{1, 0, 1, 0, 1, 0}, cb.Counts())
+}
@@ -0,0 +1,106 @@
+package gobreaker
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// EventType is a type that represents a kind of event recorded in the timeline of CircuitBreaker.
+type EventType int
+
+// These constants are kinds of events recorded in the timeline of CircuitBreaker.
+const (
+	EventAdmitted EventType = iota
+	EventRejected
+	EventSuccess
+	EventFailure
+	EventIgnored
+	EventStateChange
+)
+
+// String implements stringer interface.
+func (t EventType) String() string {
+	switch t {
+	case EventAdmitted:
+		return "admitted"
+	case EventRejected:
+		return "rejected"
+	case EventSuccess:
+		return "success"
+	case EventFailure:
+		return "failure"
+	case EventIgnored:
+		return "ignored"
+	case EventStateChange:
+		return "state_change"
+	default:
+		return fmt.Sprintf("unknown event: %d", t)
+	}
+}
+
+var outcomeEvents = [...]EventType{
+	OutcomeSuccess: EventSuccess,
+	OutcomeFailure: EventFailure,
+	OutcomeIgnore:  EventIgnored,
+}
+
+// Event is an event recorded in the timeline of CircuitBreaker.
+// From and To are the states before and after an EventStateChange,
+// and Reason is the reason of an EventRejected.
+type Event struct {
+	Time   time.Time
+	Type   EventType
+	From   State
+	To     State
+	Reason RejectReason
+}
+
+// eventTimeline is a ring buffer of the recent events.
+type eventTimeline struct {
+	mutex  sync.Mutex
+	events []Event
+	next   int
+	full   bool
+}
+
+func newEventTimeline(size int) *eventTimeline {
+	return &eventTimeline{events: make([]Event, size)}
+}
+
+func (t *eventTimeline) record(e Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.events[t.next] = e
+	t.next++
+	if t.next == len(t.events) {
+		t.next = 0
+		t.full = true
+	}
+}
+
+// snapshot returns the recorded events from the oldest to the newest.
+func (t *eventTimeline) snapshot() []Event {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.full {
+		return append([]Event(nil), t.events[:t.next]...)
+	}
+	return append(append([]Event(nil), t.events[t.next:]...), t.events[:t.next]...)
+}
+
+// EventTimeline returns the recent events of the CircuitBreaker from the oldest to the newest,
+// up to EventTimelineSize. It returns nil if EventTimelineSize is not set.
+func (cb *CircuitBreaker[T]) EventTimeline() []Event {
+	if cb.timeline == nil {
+		return nil
+	}
+	return cb.timeline.snapshot()
+}
+
+// EventTimeline returns the recent events of the TwoStepCircuitBreaker from the oldest to the newest.
+func (tscb *TwoStepCircuitBreaker[T]) EventTimeline() []Event {
+	return tscb.cb.EventTimeline()
+}
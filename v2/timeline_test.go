@@ -0,0 +1,77 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventTypeConstants(t *testing.T) {
+	assert.Equal(t, "admitted", EventAdmitted.String())
+	assert.Equal(t, "rejected", EventRejected.String())
+	assert.Equal(t, "success", EventSuccess.String())
+	assert.Equal(t, "failure", EventFailure.String())
+	assert.Equal(t, "ignored", EventIgnored.String())
+	assert.Equal(t, "state_change", EventStateChange.String())
+	assert.Equal(t, "unknown event: 100", EventType(100).String())
+}
+
+// eventTypes returns the types of events without the times.
+func eventTypes(events []Event) []Event {
+	types := make([]Event, len(events))
+	for i, e := range events {
+		e.Time = time.Time{}
+		types[i] = e
+	}
+	return types
+}
+
+func TestEventTimeline(t *testing.T) {
+	assert.Nil(t, NewCircuitBreaker[bool](Settings{}).EventTimeline())
+
+	cb := NewCircuitBreaker[bool](Settings{EventTimelineSize: 20})
+	assert.Empty(t, cb.EventTimeline())
+
+	assert.Nil(t, succeed(cb))
+	for i := 0; i < 6; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, ErrOpenState, succeed(cb))
+
+	pseudoSleep(cb, time.Duration(61)*time.Second)
+	assert.Nil(t, succeed(cb))
+
+	events := cb.EventTimeline()
+	for i := 1; i < len(events); i++ {
+		assert.False(t, events[i].Time.Before(events[i-1].Time))
+	}
+
+	admitted := Event{Type: EventAdmitted}
+	failure := Event{Type: EventFailure}
+	assert.Equal(t, []Event{
+		// succeed
+		admitted, {Type: EventSuccess},
+		// fail 6 times
+		admitted, failure, admitted, failure, admitted, failure,
+		admitted, failure, admitted, failure,
+		admitted, failure, {Type: EventStateChange, From: StateClosed, To: StateOpen},
+		// rejected
+		{Type: EventRejected, Reason: RejectOpen},
+		// succeed after Timeout
+		{Type: EventStateChange, From: StateOpen, To: StateHalfOpen}, admitted,
+		{Type: EventSuccess}, {Type: EventStateChange, From: StateHalfOpen, To: StateClosed},
+	}, eventTypes(events))
+}
+
+func TestEventTimelineCapacity(t *testing.T) {
+	cb := NewCircuitBreaker[bool](Settings{EventTimelineSize: 3})
+	assert.Nil(t, succeed(cb))
+	assert.Nil(t, fail(cb))
+
+	assert.Equal(t, []Event{
+		{Type: EventSuccess},
+		{Type: EventAdmitted},
+		{Type: EventFailure},
+	}, eventTypes(cb.EventTimeline()))
+}
@@ -0,0 +1,46 @@
+package gobreaker
+
+import (
+	"sync"
+	"time"
+)
+
+// TripOnErrorCount returns a ReadyToTrip that returns true
+// when count failures have occurred within the last window by clock, regardless of the number of successes.
+// Pass the same clock as Settings.Clock, or nil for the system clock.
+// The returned ReadyToTrip keeps the times of the recent failures by itself,
+// and forgets them when it returns true, so that the failures before a trip don't count after recovery.
+// Since it keeps its own state, each CircuitBreaker needs its own ReadyToTrip from TripOnErrorCount.
+// If count is 0, it is set to 1.
+func TripOnErrorCount(count uint32, window time.Duration, clock Clock) func(counts Counts) bool {
+	if count == 0 {
+		count = 1
+	}
+	if clock == nil {
+		clock = systemClock{}
+	}
+
+	var (
+		mutex    sync.Mutex
+		failures = make([]time.Time, count) // ring of the times of the last count failures
+		next     int
+		filled   bool
+	)
+	return func(Counts) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		t := clock.Now()
+		failures[next] = t
+		next = (next + 1) % len(failures)
+		if next == 0 {
+			filled = true
+		}
+		if !filled || t.Sub(failures[next]) >= window {
+			return false
+		}
+
+		next, filled = 0, false
+		return true
+	}
+}
@@ -0,0 +1,50 @@
+package gobreaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sony/gobreaker/v2/gobreakertest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTripOnErrorCount(t *testing.T) {
+	clock := gobreakertest.NewClock(time.Now())
+	cb := NewCircuitBreaker[bool](Settings{
+		Clock:       clock,
+		ReadyToTrip: TripOnErrorCount(100, time.Duration(10)*time.Second, clock),
+	})
+
+	// 99 failures out of 9900 requests in 9.9 seconds
+	for i := 0; i < 99; i++ {
+		for j := 0; j < 99; j++ {
+			assert.Nil(t, succeed(cb))
+		}
+		assert.Nil(t, fail(cb))
+		clock.Advance(time.Duration(100) * time.Millisecond)
+	}
+	assert.Equal(t, StateClosed, cb.State())
+
+	// the first failure is out of the window
+	clock.Advance(time.Duration(100) * time.Millisecond)
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateClosed, cb.State())
+
+	// the 100th failure within the window trips at the failure ratio of about 1%
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+
+	// the failures before the trip are forgotten
+	cb.Reset()
+	for i := 0; i < 99; i++ {
+		assert.Nil(t, fail(cb))
+	}
+	assert.Equal(t, StateClosed, cb.State())
+	assert.Nil(t, fail(cb))
+	assert.Equal(t, StateOpen, cb.State())
+}
+
+func TestTripOnErrorCountZero(t *testing.T) {
+	readyToTrip := TripOnErrorCount(0, time.Second, nil)
+	assert.True(t, readyToTrip(Counts{}))
+}